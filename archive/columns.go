@@ -0,0 +1,175 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Column is a typed column of a parquet archive schema
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// LoadSchema reads the columns of a parquet archive from a json file, e.g. [{"name": "id", "type": "string"}]
+func LoadSchema(path string) ([]Column, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var columns []Column
+	if err := json.NewDecoder(f).Decode(&columns); err != nil {
+		return nil, fmt.Errorf("error %s whilst reading schema from %s", err, path)
+	}
+	for _, c := range columns {
+		if _, ok := parquetTypes[c.Type]; !ok {
+			return nil, fmt.Errorf("unknown type %q for column %s in %s", c.Type, c.Name, path)
+		}
+	}
+	return columns, nil
+}
+
+// columnSet holds the columns of a csv or parquet archive, shared by its parts so they all have the same header
+// or schema. Without configured columns they are worked out from the first items written, attributes only
+// seen later are left out.
+type columnSet struct {
+	mu       sync.Mutex
+	names    []string
+	types    []string
+	ignored  map[string]bool
+	mismatch map[string]bool
+}
+
+func newColumnSet(o *EncodeOptions) *columnSet {
+	if len(o.Schema) == 0 {
+		return &columnSet{names: o.Columns}
+	}
+	cs := &columnSet{}
+	for _, c := range o.Schema {
+		cs.names = append(cs.names, c.Name)
+		cs.types = append(cs.types, c.Type)
+	}
+	return cs
+}
+
+// get returns the csv columns, the union of the attributes of the rows of the first page when they are not
+// configured
+func (cs *columnSet) get(rows []map[string]string) []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.names) == 0 {
+		seen := map[string]bool{}
+		for _, row := range rows {
+			for name := range row {
+				if !seen[name] {
+					seen[name] = true
+					cs.names = append(cs.names, name)
+				}
+			}
+		}
+		sort.Strings(cs.names)
+	}
+	return cs.names
+}
+
+// schema returns the typed columns, inferring them from the sample if they are not known yet
+func (cs *columnSet) schema(sample []map[string]interface{}) []Column {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.types) == 0 {
+		cs.names, cs.types = inferSchema(sample)
+	}
+	columns := make([]Column, len(cs.names))
+	for i := range cs.names {
+		columns[i] = Column{Name: cs.names[i], Type: cs.types[i]}
+	}
+	return columns
+}
+
+// known reports whether the schema has been worked out
+func (cs *columnSet) known() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return len(cs.types) != 0
+}
+
+// ignore logs the first time an attribute is left out because it has no column
+func (cs *columnSet) ignore(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.ignored == nil {
+		cs.ignored = map[string]bool{}
+	}
+	if !cs.ignored[name] {
+		cs.ignored[name] = true
+		log.Printf("attribute %s is not one of the archive columns, leaving it out", name)
+	}
+}
+
+// mismatched logs the first time a value is left out because it does not have the type of its column
+func (cs *columnSet) mismatched(name, typ string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.mismatch == nil {
+		cs.mismatch = map[string]bool{}
+	}
+	if !cs.mismatch[name] {
+		cs.mismatch[name] = true
+		log.Printf("values of %s which are not %s are written as null", name, typ)
+	}
+}
+
+// inferSchema types every attribute of the sample by its values. Numbers are doubles, as a sample can not tell
+// whether later values have a fraction, and attributes with values of different kinds, maps, lists and sets
+// are json.
+func inferSchema(sample []map[string]interface{}) ([]string, []string) {
+	kinds := map[string]string{}
+	for _, item := range sample {
+		for name, v := range item {
+			k := valueType(v)
+			switch prev, seen := kinds[name]; {
+			case !seen || prev == "":
+				kinds[name] = k
+			case k == "" || k == prev:
+			default:
+				kinds[name] = ColumnJSON
+			}
+		}
+	}
+
+	var names, types []string
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := kinds[name]
+		if t == "" {
+			t = ColumnString
+		}
+		types = append(types, t)
+	}
+	return names, types
+}
+
+func valueType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case string:
+		return ColumnString
+	case float64:
+		return ColumnDouble
+	case bool:
+		return ColumnBoolean
+	case []byte:
+		return ColumnBinary
+	}
+	return ColumnJSON
+}
@@ -0,0 +1,128 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// FlattenJSON writes nested maps and lists as json text in a single column
+	FlattenJSON = "json"
+	// FlattenDot writes every attribute of a nested map to its own parent.child column, lists stay json
+	FlattenDot = "dot"
+)
+
+type csvEncoder struct {
+	w       io.Writer
+	columns *columnSet
+	flatten string
+	header  bool
+	wrote   bool
+}
+
+func newCSVEncoder(w io.Writer, f *format) pageEncoder {
+	return &csvEncoder{w: w, columns: f.columns, flatten: f.options.Flatten, header: !f.options.NoHeader}
+}
+
+// encode buffers the whole page so it reaches the part in a single write, every part starts with the header
+func (e *csvEncoder) encode(items []map[string]interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+	rows := make([]map[string]string, len(items))
+	for i, item := range items {
+		row := map[string]string{}
+		if err := flattenItem(row, "", item, e.flatten); err != nil {
+			return err
+		}
+		rows[i] = row
+	}
+
+	columns := e.columns.get(rows)
+	known := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		known[c] = true
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if e.header && !e.wrote {
+		w.Write(columns)
+	}
+	e.wrote = true
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for name := range row {
+			if !known[name] {
+				e.columns.ignore(name)
+			}
+		}
+		for i, c := range columns {
+			record[i] = row[c]
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// close writes the header of a part with no items
+func (e *csvEncoder) close() error {
+	if !e.header || e.wrote {
+		return nil
+	}
+	e.columns.mu.Lock()
+	columns := e.columns.names
+	e.columns.mu.Unlock()
+	if len(columns) == 0 {
+		return nil
+	}
+	w := csv.NewWriter(e.w)
+	w.Write(columns)
+	w.Flush()
+	return w.Error()
+}
+
+// flattenItem turns the attributes of an item into csv cells keyed by column name
+func flattenItem(row map[string]string, prefix string, item map[string]interface{}, flatten string) error {
+	for name, v := range item {
+		if m, ok := v.(map[string]interface{}); ok && flatten == FlattenDot {
+			if err := flattenItem(row, prefix+name+".", m, flatten); err != nil {
+				return err
+			}
+			continue
+		}
+		cell, err := csvCell(v)
+		if err != nil {
+			return fmt.Errorf("error %s whilst writing attribute %s to csv", err, prefix+name)
+		}
+		row[prefix+name] = cell
+	}
+	return nil
+}
+
+func csvCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCSVColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *EncodeOptions
+		pages   [][]map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "union of the first page",
+			options: &EncodeOptions{},
+			pages: [][]map[string]interface{}{
+				{{"id": "a"}, {"id": "b", "n": 1.5}, {"id": "c", "ok": true}},
+				{{"id": "d", "late": "x"}},
+			},
+			want: "id,n,ok\na,,\nb,1.5,\nc,,true\nd,,\n",
+		},
+		{
+			name:    "configured columns",
+			options: &EncodeOptions{Columns: []string{"n", "id"}},
+			pages:   [][]map[string]interface{}{{{"id": "a", "n": 2.0, "ok": false}}},
+			want:    "n,id\n2,a\n",
+		},
+		{
+			name:    "flattened and without a header",
+			options: &EncodeOptions{Flatten: FlattenDot, NoHeader: true},
+			pages:   [][]map[string]interface{}{{{"id": "a", "m": map[string]interface{}{"x": "y"}}, {"id": "b", "l": []interface{}{"z"}}}},
+			want:    "a,,y\nb,\"[\"\"z\"\"]\",\n",
+		},
+	}
+	for _, tt := range tests {
+		f, err := lookupFormat(FormatCSV, tt.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		e := f.newEncoder(&buf)
+		for _, page := range tt.pages {
+			if err := e.encode(page); err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+		}
+		if err := e.close(); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: wrote\n%s\nwant\n%s", tt.name, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	// FormatJSON writes a json array of items per scanned page
+	FormatJSON = "json"
+	// FormatJSONLines writes a json object per item, one per line
+	FormatJSONLines = "jsonl"
+	// FormatCSV writes a csv row per item
+	FormatCSV = "csv"
+	// FormatParquet writes a parquet file per part with a row group every so many items
+	FormatParquet = "parquet"
+)
+
+// pageEncoder writes pages of items to a single part object in one of the archive formats
+type pageEncoder interface {
+	encode(items []map[string]interface{}) error
+	// close writes whatever the format needs at the end of a part
+	close() error
+}
+
+// format describes how the items of an archive are encoded
+type format struct {
+	name        string
+	ext         string
+	contentType string
+	encoder     func(w io.Writer, f *format) pageEncoder
+	options     *EncodeOptions
+	// columns are shared by the parts of an archive so they all have the same header or schema
+	columns *columnSet
+}
+
+// EncodeOptions configures the formats which need more than the items to encode them
+type EncodeOptions struct {
+	// Columns of a csv archive, when empty they are the attributes of the first page
+	Columns []string
+	// Flatten is how nested maps are written to csv (json|dot)
+	Flatten string
+	// NoHeader leaves out the csv header row
+	NoHeader bool
+	// Schema of a parquet archive, when empty it is inferred from the first Sample items
+	Schema []Column
+	Sample int
+	// RowGroupItems is how many items go in each parquet row group
+	RowGroupItems int
+}
+
+func (f *format) newEncoder(w io.Writer) pageEncoder {
+	return f.encoder(w, f)
+}
+
+var formats = map[string]*format{
+	FormatJSON: {
+		name:        FormatJSON,
+		ext:         ".json",
+		contentType: "application/json",
+		encoder:     func(w io.Writer, f *format) pageEncoder { return &jsonArrayEncoder{w: w} },
+	},
+	FormatJSONLines: {
+		name:        FormatJSONLines,
+		ext:         ".jsonl",
+		contentType: "application/x-ndjson",
+		encoder:     func(w io.Writer, f *format) pageEncoder { return &jsonLinesEncoder{w: w} },
+	},
+	FormatCSV: {
+		name:        FormatCSV,
+		ext:         ".csv",
+		contentType: "text/csv",
+		encoder:     newCSVEncoder,
+	},
+	FormatParquet: {
+		name:        FormatParquet,
+		ext:         ".parquet",
+		contentType: "application/octet-stream",
+		encoder:     newParquetEncoder,
+	},
+}
+
+// lookupFormat returns the named format with its encoders configured by the options
+func lookupFormat(name string, o *EncodeOptions) (*format, error) {
+	if name == "" {
+		name = FormatJSON
+	}
+	f, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown archive format %q", name)
+	}
+	if o == nil {
+		o = &EncodeOptions{}
+	}
+	if o.Flatten != "" && o.Flatten != FlattenJSON && o.Flatten != FlattenDot {
+		return nil, fmt.Errorf("unknown flatten rule %q, expected json or dot", o.Flatten)
+	}
+	configured := *f
+	configured.options = o
+	configured.columns = newColumnSet(o)
+	return &configured, nil
+}
+
+type jsonArrayEncoder struct {
+	w io.Writer
+}
+
+func (e *jsonArrayEncoder) encode(items []map[string]interface{}) error {
+	return json.NewEncoder(e.w).Encode(items)
+}
+
+func (e *jsonArrayEncoder) close() error { return nil }
+
+type jsonLinesEncoder struct {
+	w io.Writer
+}
+
+// encode buffers the whole page so it reaches the part in a single write
+func (e *jsonLinesEncoder) encode(items []map[string]interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *jsonLinesEncoder) close() error { return nil }
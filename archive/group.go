@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Group archives the tables concurrently under one run id, each like ToS3 but to <prefix>/<date>/<run id>/<table>,
+// then writes <prefix>/<date>/<run id>.group.json linking the manifests of every table. Concurrency limits how
+// many tables are archived at once, 0 archives them all at once.
+func Group(c *S3ArchiveConfig, tables []string, concurrency int) error {
+	if c.Retry != "" {
+		return fmt.Errorf("a group archive can not be retried, retry the archive of the table which failed")
+	}
+	if concurrency < 1 || concurrency > len(tables) {
+		concurrency = len(tables)
+	}
+
+	runID := checkpoint.NewRunID()
+	baseKey := generateBackupKey(c.BackupPrefix, runID)
+	g := &manifest.Group{
+		RunID:     runID,
+		StartedAt: time.Now().UTC(),
+		Tables:    make([]manifest.GroupTable, len(tables)),
+	}
+	log.Printf("archiving %d tables under run id %s", len(tables), runID)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, table := range tables {
+		i, table := i, table
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			tc := *c
+			tc.TableName = table
+			key, err := archiveTable(&tc, baseKey+"/"+table)
+			gt := manifest.GroupTable{Table: table, Manifest: key, Status: manifest.StatusComplete}
+			if err != nil {
+				log.Printf("error %s whilst archiving %s", err, table)
+				gt.Status = manifest.StatusFailed
+				gt.Error = err.Error()
+			}
+			g.Tables[i] = gt
+		}()
+	}
+	wg.Wait()
+
+	g.CompletedAt = time.Now().UTC()
+	g.Status = manifest.StatusComplete
+	failed := 0
+	for _, gt := range g.Tables {
+		if gt.Status != manifest.StatusComplete {
+			failed++
+			g.Status = manifest.StatusFailed
+		}
+	}
+	key := manifest.GroupKey(baseKey)
+	if err := manifest.WriteGroup(s3.New(awssession.New(c.Region)), c.UploadBucket, key, g); err != nil {
+		log.Printf("error %s whilst writing the group manifest", err)
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d tables failed, see %s", failed, len(tables), key)
+	}
+	log.Printf("Group backup completed! %d tables listed in %s", len(tables), key)
+	return nil
+}
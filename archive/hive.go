@@ -0,0 +1,280 @@
+package archive
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// hiveDefaultPartition is where hive puts rows without a value for the partition
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// dateLayouts are the date granularities an attribute can be partitioned by
+var dateLayouts = map[string]string{
+	"year":  "2006",
+	"month": "2006-01",
+	"day":   "2006-01-02",
+	"hour":  "2006-01-02-15",
+}
+
+// hivePartitioner works out the hive style partition of an item from an attribute, or from a date extracted
+// from it when a granularity is given.
+type hivePartitioner struct {
+	attribute string
+	layout    string
+}
+
+// parseHivePartitioner parses <attribute> or <attribute>:<year|month|day|hour>
+func parseHivePartitioner(spec string) (*hivePartitioner, error) {
+	p := &hivePartitioner{attribute: spec}
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		layout, ok := dateLayouts[spec[i+1:]]
+		if !ok {
+			return nil, fmt.Errorf("unknown date granularity %q, expected year, month, day or hour", spec[i+1:])
+		}
+		p.attribute, p.layout = spec[:i], layout
+	}
+	if p.attribute == "" {
+		return nil, fmt.Errorf("missing attribute to partition by in %q", spec)
+	}
+	return p, nil
+}
+
+// partition returns the partition of the item, e.g. country=AU
+func (p *hivePartitioner) partition(item map[string]interface{}) string {
+	value := hiveDefaultPartition
+	if v, ok := p.value(item[p.attribute]); ok && v != "" {
+		value = escapePartition(v)
+	}
+	return p.attribute + "=" + value
+}
+
+func (p *hivePartitioner) value(v interface{}) (string, bool) {
+	if p.layout == "" {
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+		return "", false
+	}
+
+	var t time.Time
+	switch v := v.(type) {
+	case string:
+		var err error
+		if t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			if t, err = time.Parse("2006-01-02", v); err != nil {
+				return "", false
+			}
+		}
+	case float64:
+		// epoch seconds, or milliseconds for values too big to be seconds.
+		if v > 1e11 {
+			t = time.Unix(0, int64(v)*int64(time.Millisecond))
+		} else {
+			t = time.Unix(int64(v), 0)
+		}
+	default:
+		return "", false
+	}
+	return t.UTC().Format(p.layout), true
+}
+
+// escapePartition escapes the characters hive escapes in partition values, so they are safe in a key
+func escapePartition(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// partitionedOutput routes every item to the parts of its partition under <baseKey>/<attribute>=<value>/. The
+// partitions are shared by the segments and each rolls over to new parts on its own.
+//
+// Every open part holds an upload buffer, so at most maxOpen partitions have a part open. Writing to another
+// one finishes the part of the least recently written partition, which starts its next part when it is written
+// to again. Partitions being written by a segment at that moment are not finished, so with more segments than
+// maxOpen up to one partition per segment can be open.
+type partitionedOutput struct {
+	mu          sync.Mutex
+	uploader    *s3manager.Uploader
+	bucket      string
+	baseKey     string
+	format      *format
+	maxBytes    int64
+	maxItems    int64
+	partitioner *hivePartitioner
+	writers     map[string]*partition
+	maxOpen     int
+	// open lists the partitions which may have a part open, the most recently written first
+	open *list.List
+}
+
+type partition struct {
+	w *partWriter
+	// users is how many segments are writing to the partition
+	users int
+	// elem is the partition's element of the open list, nil when it has no part open
+	elem *list.Element
+}
+
+func newPartitionedOutput(u *s3manager.Uploader, bucket, baseKey string, f *format, maxBytes, maxItems int64, p *hivePartitioner, maxOpen int) *partitionedOutput {
+	if maxOpen < 1 {
+		maxOpen = 1
+	}
+	return &partitionedOutput{
+		uploader:    u,
+		bucket:      bucket,
+		baseKey:     baseKey,
+		format:      f,
+		maxBytes:    maxBytes,
+		maxItems:    maxItems,
+		partitioner: p,
+		writers:     map[string]*partition{},
+		maxOpen:     maxOpen,
+		open:        list.New(),
+	}
+}
+
+func (o *partitionedOutput) segment(n int) pageWriter           { return o }
+func (o *partitionedOutput) segmentDone(n int, err error) error { return err }
+func (o *partitionedOutput) failedSegments() []int              { return nil }
+
+// WritePage splits the page by partition, keeping the order of the items within each partition
+func (o *partitionedOutput) WritePage(items []map[string]interface{}) error {
+	var order []string
+	pages := map[string][]map[string]interface{}{}
+	for _, item := range items {
+		key := o.partitioner.partition(item)
+		if _, ok := pages[key]; !ok {
+			order = append(order, key)
+		}
+		pages[key] = append(pages[key], item)
+	}
+	for _, key := range order {
+		p, evicted := o.acquire(key)
+		var err error
+		for _, e := range evicted {
+			if ferr := e.Flush(); err == nil {
+				err = ferr
+			}
+		}
+		if err == nil {
+			err = p.w.WritePage(pages[key])
+		}
+		o.release(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close is a no-op, the partitions are shared by every segment and only closed with the output
+func (o *partitionedOutput) Close() error {
+	return nil
+}
+
+// acquire returns the partition to write to, marking it the most recently written, and the writers of the least
+// recently written partitions whose parts have to be finished to keep within maxOpen
+func (o *partitionedOutput) acquire(key string) (*partition, []*partWriter) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, ok := o.writers[key]
+	if !ok {
+		w := newPartWriter(o.uploader, o.bucket, o.baseKey+"/"+key, o.format, o.maxBytes, o.maxItems)
+		w.folder = true
+		p = &partition{w: w}
+		o.writers[key] = p
+	}
+	p.users++
+	if p.elem != nil {
+		o.open.MoveToFront(p.elem)
+	} else {
+		p.elem = o.open.PushFront(p)
+	}
+
+	var evicted []*partWriter
+	for e := o.open.Back(); e != nil && o.open.Len() > o.maxOpen; {
+		prev := e.Prev()
+		if lru := e.Value.(*partition); lru.users == 0 {
+			o.open.Remove(e)
+			lru.elem = nil
+			evicted = append(evicted, lru.w)
+		}
+		e = prev
+	}
+	return p, evicted
+}
+
+func (o *partitionedOutput) release(p *partition) {
+	o.mu.Lock()
+	p.users--
+	o.mu.Unlock()
+}
+
+func (o *partitionedOutput) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var err error
+	for _, p := range o.writers {
+		if cerr := p.w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (o *partitionedOutput) parts() []manifest.Part {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var parts []manifest.Part
+	for key, pt := range o.writers {
+		for _, p := range pt.w.Parts() {
+			p.Partition = key
+			parts = append(parts, p)
+		}
+	}
+	sort.Sort(byKey(parts))
+	return parts
+}
+
+// partitions summarises the parts of every partition for the manifest
+func (o *partitionedOutput) partitions() []manifest.Partition {
+	byPartition := map[string]*manifest.Partition{}
+	var keys []string
+	for _, p := range o.parts() {
+		mp, ok := byPartition[p.Partition]
+		if !ok {
+			mp = &manifest.Partition{Key: p.Partition, Prefix: o.baseKey + "/" + p.Partition + "/"}
+			byPartition[p.Partition] = mp
+			keys = append(keys, p.Partition)
+		}
+		mp.Parts++
+		mp.Items += p.Items
+		mp.Bytes += p.Bytes
+	}
+	sort.Strings(keys)
+	partitions := make([]manifest.Partition, len(keys))
+	for i, key := range keys {
+		partitions[i] = *byPartition[key]
+	}
+	return partitions
+}
@@ -0,0 +1,44 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPartitionedOutputEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxOpen int
+		// writes are the partitions written in order, a key ending in + stays in use until the end
+		writes []string
+		// evicted are the partitions finished by each write
+		evicted [][]string
+	}{
+		{"within the limit", 2, []string{"a", "b", "a"}, [][]string{nil, nil, nil}},
+		{"least recently written", 2, []string{"a", "b", "a", "c", "b"}, [][]string{nil, nil, nil, {"b"}, {"a"}}},
+		{"one open", 1, []string{"a", "b", "b", "a"}, [][]string{nil, {"a"}, nil, {"b"}}},
+		{"in use is kept", 1, []string{"a+", "b", "c"}, [][]string{nil, nil, {"b"}}},
+	}
+	for _, tt := range tests {
+		o := newPartitionedOutput(nil, "bucket", "t", nil, 0, 0, nil, tt.maxOpen)
+		names := map[*partWriter]string{}
+		for i, key := range tt.writes {
+			inUse := key[len(key)-1] == '+'
+			if inUse {
+				key = key[:len(key)-1]
+			}
+			p, evicted := o.acquire(key)
+			names[p.w] = key
+			var got []string
+			for _, w := range evicted {
+				got = append(got, names[w])
+			}
+			if !reflect.DeepEqual(got, tt.evicted[i]) {
+				t.Errorf("%s: writing %s finished %v, want %v", tt.name, key, got, tt.evicted[i])
+			}
+			if !inUse {
+				o.release(p)
+			}
+		}
+	}
+}
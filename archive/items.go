@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ItemArchive writes pages of items to a json lines archive with a manifest, so a bulk change can keep the
+// items it is about to remove in a form restore reads back.
+type ItemArchive struct {
+	s       *session.Session
+	bucket  string
+	baseKey string
+	out     output
+	m       *manifest.Manifest
+}
+
+// NewItemArchive starts an archive of the items of the table a delete removes, under the prefix like ToS3 but
+// keyed <table>-deleted-<run id> and of kind deleted, so it is never taken for a full archive of the table.
+func NewItemArchive(s *session.Session, bucket, prefix, table string) (*ItemArchive, error) {
+	f, err := lookupFormat(FormatJSONLines, nil)
+	if err != nil {
+		return nil, err
+	}
+	baseKey := generateBackupKey(prefix, table+"-deleted-"+checkpoint.NewRunID())
+	return &ItemArchive{
+		s:       s,
+		bucket:  bucket,
+		baseKey: baseKey,
+		out:     newSharedOutput(s3manager.NewUploader(s), bucket, baseKey, f, 0, 0),
+		m: &manifest.Manifest{
+			Table:     table,
+			Kind:      manifest.KindDeleted,
+			Format:    f.name,
+			StartedAt: time.Now().UTC(),
+		},
+	}, nil
+}
+
+// Write adds a page of items to the archive, it is safe to call from several goroutines
+func (a *ItemArchive) Write(items []map[string]interface{}) error {
+	return a.out.segment(0).WritePage(items)
+}
+
+// Close uploads the rest of the archive and writes its manifest, marked failed when the items could not all be
+// written. It returns the key of the manifest.
+func (a *ItemArchive) Close(failed error) (string, error) {
+	err := a.out.close()
+	if err == nil {
+		err = failed
+	}
+	a.m.CompletedAt = time.Now().UTC()
+	a.m.Parts = a.out.parts()
+	a.m.Status = manifest.StatusComplete
+	if err != nil {
+		a.m.Status = manifest.StatusFailed
+	}
+	key := manifest.Key(a.baseKey)
+	if merr := manifest.Write(s3.New(a.s), a.bucket, key, a.m); merr != nil {
+		log.Printf("error %s whilst writing the manifest", merr)
+		if err == nil {
+			err = merr
+		}
+	}
+	if err != nil {
+		return key, fmt.Errorf("archive %s is incomplete: %v", key, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,186 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// maxDeleteObjects is the most keys a single DeleteObjects request takes
+const maxDeleteObjects = 1000
+
+// output hands out the page writers for the scan segments and collects the parts they upload
+type output interface {
+	// segment returns the writer for the pages of the scan segment
+	segment(n int) pageWriter
+	// segmentDone is called once the segment has been scanned, with the error it failed with if any.
+	// A non nil return aborts the whole scan.
+	segmentDone(n int, err error) error
+	close() error
+	parts() []manifest.Part
+	failedSegments() []int
+}
+
+// sharedOutput writes the pages of every segment to the same series of parts
+type sharedOutput struct {
+	w *partWriter
+}
+
+func newSharedOutput(u *s3manager.Uploader, bucket, baseKey string, f *format, maxBytes, maxItems int64) output {
+	return &sharedOutput{w: newPartWriter(u, bucket, baseKey, f, maxBytes, maxItems)}
+}
+
+func (o *sharedOutput) segment(n int) pageWriter           { return o.w }
+func (o *sharedOutput) segmentDone(n int, err error) error { return err }
+func (o *sharedOutput) close() error                       { return o.w.Close() }
+func (o *sharedOutput) parts() []manifest.Part             { return o.w.Parts() }
+func (o *sharedOutput) failedSegments() []int              { return nil }
+
+// segmentOutput gives every segment its own series of parts under <baseKey>/segment-0001, so segments do not
+// contend on a single writer and a failed segment can be scanned again on its own.
+type segmentOutput struct {
+	mu       sync.Mutex
+	uploader *s3manager.Uploader
+	bucket   string
+	baseKey  string
+	format   *format
+	maxBytes int64
+	maxItems int64
+	writers  map[int]*partWriter
+	done     []manifest.Part
+	failed   []int
+}
+
+func newSegmentOutput(u *s3manager.Uploader, bucket, baseKey string, f *format, maxBytes, maxItems int64) *segmentOutput {
+	return &segmentOutput{
+		uploader: u,
+		bucket:   bucket,
+		baseKey:  baseKey,
+		format:   f,
+		maxBytes: maxBytes,
+		maxItems: maxItems,
+		writers:  map[int]*partWriter{},
+	}
+}
+
+func (o *segmentOutput) segmentKey(n int) string {
+	return fmt.Sprintf("%s/segment-%04d", o.baseKey, n)
+}
+
+func (o *segmentOutput) segment(n int) pageWriter {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	w := newPartWriter(o.uploader, o.bucket, o.segmentKey(n), o.format, o.maxBytes, o.maxItems)
+	o.writers[n] = w
+	return w
+}
+
+func (o *segmentOutput) segmentDone(n int, err error) error {
+	o.mu.Lock()
+	w := o.writers[n]
+	delete(o.writers, n)
+	o.mu.Unlock()
+
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err != nil {
+		// the parts of a failed segment are removed so restores of the prefix never read half a segment.
+		if derr := o.removeSegment(n); derr != nil {
+			log.Printf("error %s whilst removing the parts of failed segment %d", derr, n)
+		}
+		log.Printf("segment %d failed, retry it with --retry on the manifest", n)
+		o.failed = append(o.failed, n)
+		return nil
+	}
+	for _, p := range w.Parts() {
+		segment := n
+		p.Segment = &segment
+		o.done = append(o.done, p)
+	}
+	return nil
+}
+
+// clear removes the parts a previous run uploaded for the segments, before they are scanned again
+func (o *segmentOutput) clear(segments []int) error {
+	for _, n := range segments {
+		if err := o.removeSegment(n); err != nil {
+			return fmt.Errorf("error %s whilst removing the parts of segment %d", err, n)
+		}
+	}
+	return nil
+}
+
+// removeSegment deletes the objects of the segment, <segment>.ext or everything under <segment>/
+func (o *segmentOutput) removeSegment(n int) error {
+	svc := o.uploader.S3
+	keys := []string{o.segmentKey(n) + o.format.ext}
+	err := svc.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(o.bucket),
+		Prefix: aws.String(o.segmentKey(n) + "/"),
+	}, func(p *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range p.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > maxDeleteObjects {
+			batch = batch[:maxDeleteObjects]
+		}
+		keys = keys[len(batch):]
+		del := &s3.Delete{Quiet: aws.Bool(true)}
+		for _, k := range batch {
+			del.Objects = append(del.Objects, &s3.ObjectIdentifier{Key: aws.String(k)})
+		}
+		out, err := svc.DeleteObjects(&s3.DeleteObjectsInput{Bucket: aws.String(o.bucket), Delete: del})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) != 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("%d objects not deleted, %s: %s", len(out.Errors), aws.StringValue(e.Key), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
+
+func (o *segmentOutput) close() error {
+	return nil
+}
+
+func (o *segmentOutput) parts() []manifest.Part {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	parts := append([]manifest.Part(nil), o.done...)
+	sort.Sort(byKey(parts))
+	return parts
+}
+
+func (o *segmentOutput) failedSegments() []int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	failed := append([]int(nil), o.failed...)
+	sort.Ints(failed)
+	return failed
+}
+
+type byKey []manifest.Part
+
+func (p byKey) Len() int           { return len(p) }
+func (p byKey) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byKey) Less(i, j int) bool { return p[i].Key < p[j].Key }
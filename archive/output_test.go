@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// fakeBucket is an in memory bucket which only lists and deletes
+type fakeBucket struct {
+	s3iface.S3API
+	keys map[string]bool
+}
+
+func (b *fakeBucket) ListObjectsPages(input *s3.ListObjectsInput, fn func(*s3.ListObjectsOutput, bool) bool) error {
+	out := &s3.ListObjectsOutput{}
+	for k := range b.keys {
+		if strings.HasPrefix(k, aws.StringValue(input.Prefix)) {
+			out.Contents = append(out.Contents, &s3.Object{Key: aws.String(k)})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func (b *fakeBucket) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	if len(input.Delete.Objects) > maxDeleteObjects {
+		return nil, fmt.Errorf("%d keys in one request", len(input.Delete.Objects))
+	}
+	for _, o := range input.Delete.Objects {
+		delete(b.keys, aws.StringValue(o.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func TestRemoveSegment(t *testing.T) {
+	f, err := lookupFormat(FormatJSONLines, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := map[string]bool{"t/segment-0011.jsonl": true}
+	for i := 0; i < 2500; i++ {
+		many[fmt.Sprintf("t/segment-0002/part-%05d.jsonl", i)] = true
+	}
+	tests := []struct {
+		name    string
+		keys    map[string]bool
+		segment int
+		want    []string
+	}{
+		{"single object", map[string]bool{"t/segment-0001.jsonl": true, "t/segment-0002.jsonl": true}, 1, []string{"t/segment-0002.jsonl"}},
+		{"parts", map[string]bool{"t/segment-0001/part-00001.jsonl": true, "t/segment-0001/part-00002.jsonl": true, "t/segment-0010/part-00001.jsonl": true}, 1, []string{"t/segment-0010/part-00001.jsonl"}},
+		{"more than one request", many, 2, []string{"t/segment-0011.jsonl"}},
+		{"nothing uploaded", map[string]bool{}, 3, nil},
+	}
+	for _, tt := range tests {
+		b := &fakeBucket{keys: tt.keys}
+		o := newSegmentOutput(&s3manager.Uploader{S3: b}, "bucket", "t", f, 0, 0)
+		if err := o.removeSegment(tt.segment); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		var left []string
+		for k := range b.keys {
+			left = append(left, k)
+		}
+		sort.Strings(left)
+		if !reflect.DeepEqual(left, tt.want) {
+			t.Errorf("%s: left %v, want %v", tt.name, left, tt.want)
+		}
+	}
+}
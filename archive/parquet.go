@@ -0,0 +1,531 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+)
+
+// column types of a parquet archive
+const (
+	ColumnString  = "string"
+	ColumnInt64   = "int64"
+	ColumnDouble  = "double"
+	ColumnBoolean = "boolean"
+	ColumnBinary  = "binary"
+	// ColumnJSON holds maps, lists and sets as json text
+	ColumnJSON = "json"
+)
+
+// parquet physical types, converted types, logical types, encodings and codec from the parquet thrift definitions
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	convertedUTF8  = 0
+	convertedInt64 = 18
+	convertedJSON  = 19
+
+	// the LogicalType union fields
+	logicalString  = 1
+	logicalInteger = 10
+	logicalJSON    = 12
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip = 2
+
+	parquetMagic = "PAR1"
+)
+
+type parquetType struct {
+	physical  int32
+	converted int32
+	logical   int16
+}
+
+// parquetTypes maps the column types to parquet. A converted type of -1 and a logical type of 0 mean none, the
+// converted types are written as well as the logical types for readers which predate them.
+var parquetTypes = map[string]parquetType{
+	ColumnString:  {parquetByteArray, convertedUTF8, logicalString},
+	ColumnInt64:   {parquetInt64, convertedInt64, logicalInteger},
+	ColumnDouble:  {parquetDouble, -1, 0},
+	ColumnBoolean: {parquetBoolean, -1, 0},
+	ColumnBinary:  {parquetByteArray, -1, 0},
+	ColumnJSON:    {parquetByteArray, convertedJSON, logicalJSON},
+}
+
+// columnChunk is the metadata of a column of a row group
+type columnChunk struct {
+	column           Column
+	offset           int64
+	values           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	rows    int64
+}
+
+// parquetEncoder writes a parquet file per part. Items are held back until there are enough to infer the
+// schema from, then written as a row group every rowGroupItems items, with a single gzipped page per column.
+// Every column is optional and flat, maps, lists and sets are json.
+type parquetEncoder struct {
+	w         io.Writer
+	columns   *columnSet
+	sample    int
+	groupSize int
+	pending   []map[string]interface{}
+	pos       int64
+	groups    []rowGroup
+}
+
+func newParquetEncoder(w io.Writer, f *format) pageEncoder {
+	e := &parquetEncoder{w: w, columns: f.columns, sample: f.options.Sample, groupSize: f.options.RowGroupItems}
+	if e.sample < 1 {
+		e.sample = 1000
+	}
+	if e.groupSize < 1 {
+		e.groupSize = 10000
+	}
+	return e
+}
+
+func (e *parquetEncoder) encode(items []map[string]interface{}) error {
+	e.pending = append(e.pending, items...)
+	if !e.columns.known() && len(e.pending) < e.sample {
+		return nil
+	}
+	schema := e.columns.schema(e.pending)
+	for len(e.pending) >= e.groupSize {
+		if err := e.writeRowGroup(schema, e.pending[:e.groupSize]); err != nil {
+			return err
+		}
+		e.pending = e.pending[e.groupSize:]
+	}
+	return nil
+}
+
+// close writes the items still held back and the footer
+func (e *parquetEncoder) close() error {
+	schema := e.columns.schema(e.pending)
+	if len(e.pending) != 0 {
+		if err := e.writeRowGroup(schema, e.pending); err != nil {
+			return err
+		}
+		e.pending = nil
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	footer := e.footer(schema)
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(footer)))
+	return e.write(footer, size, []byte(parquetMagic))
+}
+
+func (e *parquetEncoder) start() error {
+	if e.pos != 0 {
+		return nil
+	}
+	return e.write([]byte(parquetMagic))
+}
+
+func (e *parquetEncoder) write(bs ...[]byte) error {
+	for _, b := range bs {
+		n, err := e.w.Write(b)
+		e.pos += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *parquetEncoder) writeRowGroup(schema []Column, items []map[string]interface{}) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(schema))
+	for _, c := range schema {
+		known[c.Name] = true
+	}
+	for _, item := range items {
+		for name := range item {
+			if !known[name] {
+				e.columns.ignore(name)
+			}
+		}
+	}
+
+	g := rowGroup{rows: int64(len(items))}
+	for _, c := range schema {
+		chunk, err := e.writeColumn(c, items)
+		if err != nil {
+			return err
+		}
+		g.columns = append(g.columns, chunk)
+	}
+	e.groups = append(e.groups, g)
+	return nil
+}
+
+// writeColumn writes the values of the column as a data page of definition levels followed by the plain
+// encoded values which are not null.
+func (e *parquetEncoder) writeColumn(c Column, items []map[string]interface{}) (columnChunk, error) {
+	var values bytes.Buffer
+	defined := make([]bool, len(items))
+	var bools []bool
+	for i, item := range items {
+		v, ok := item[c.Name]
+		if !ok || v == nil {
+			continue
+		}
+		if defined[i] = e.plain(&values, &bools, c, v); !defined[i] {
+			e.columns.mismatched(c.Name, c.Type)
+		}
+	}
+	if c.Type == ColumnBoolean {
+		values.Write(bitPack(bools))
+	}
+
+	var page bytes.Buffer
+	levels := rleBitPacked(defined)
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(levels)))
+	page.Write(size)
+	page.Write(levels)
+	page.Write(values.Bytes())
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(page.Bytes())
+	if err := gz.Close(); err != nil {
+		return columnChunk{}, err
+	}
+
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(page.Len()))
+	t.i32(3, int32(compressed.Len()))
+	t.structField(5)
+	t.i32(1, int32(len(items)))
+	t.i32(2, encodingPlain)
+	t.i32(3, encodingRLE)
+	t.i32(4, encodingRLE)
+	t.endStruct()
+	t.endStruct()
+
+	chunk := columnChunk{
+		column:           c,
+		offset:           e.pos,
+		values:           int64(len(items)),
+		uncompressedSize: int64(t.buf.Len() + page.Len()),
+		compressedSize:   int64(t.buf.Len() + compressed.Len()),
+	}
+	return chunk, e.write(t.buf.Bytes(), compressed.Bytes())
+}
+
+// plain appends the plain encoding of the value, it returns false if the value does not have the column type
+func (e *parquetEncoder) plain(buf *bytes.Buffer, bools *[]bool, c Column, v interface{}) bool {
+	switch c.Type {
+	case ColumnString:
+		s, err := csvCell(v)
+		if err != nil {
+			return false
+		}
+		writeByteArray(buf, []byte(s))
+	case ColumnJSON:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		writeByteArray(buf, b)
+	case ColumnBinary:
+		switch v := v.(type) {
+		case []byte:
+			writeByteArray(buf, v)
+		case string:
+			writeByteArray(buf, []byte(v))
+		default:
+			return false
+		}
+	case ColumnInt64:
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return false
+		}
+		binary.Write(buf, binary.LittleEndian, int64(n))
+	case ColumnDouble:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		binary.Write(buf, binary.LittleEndian, math.Float64bits(n))
+	case ColumnBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return false
+		}
+		*bools = append(*bools, b)
+	}
+	return true
+}
+
+func writeByteArray(buf *bytes.Buffer, b []byte) {
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(len(b)))
+	buf.Write(size)
+	buf.Write(b)
+}
+
+// rleBitPacked encodes the definition levels, a bit each, as a single bit packed run of the hybrid encoding
+func rleBitPacked(levels []bool) []byte {
+	groups := (len(levels) + 7) / 8
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(groups)<<1|1)
+	return append(header[:n], bitPack(levels)...)
+}
+
+func bitPack(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// footer encodes the FileMetaData of the part
+func (e *parquetEncoder) footer(schema []Column) []byte {
+	var rows int64
+	for _, g := range e.groups {
+		rows += g.rows
+	}
+
+	t := &thriftWriter{}
+	t.beginStruct()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(schema)+1)
+	t.beginStruct()
+	t.str(4, "schema")
+	t.i32(5, int32(len(schema)))
+	t.endStruct()
+	for _, c := range schema {
+		pt := parquetTypes[c.Type]
+		t.beginStruct()
+		t.i32(1, pt.physical)
+		t.i32(3, 1) // OPTIONAL
+		t.str(4, c.Name)
+		if pt.converted >= 0 {
+			t.i32(6, pt.converted)
+		}
+		if pt.logical != 0 {
+			t.structField(10)
+			t.structField(pt.logical)
+			if pt.logical == logicalInteger {
+				t.i8(1, 64)
+				t.boolean(2, true)
+			}
+			t.endStruct()
+			t.endStruct()
+		}
+		t.endStruct()
+	}
+	t.i64(3, rows)
+
+	t.list(4, thriftStruct, len(e.groups))
+	for _, g := range e.groups {
+		var size int64
+		for _, c := range g.columns {
+			size += c.uncompressedSize
+		}
+		t.beginStruct()
+		t.list(1, thriftStruct, len(g.columns))
+		for _, c := range g.columns {
+			t.beginStruct()
+			t.i64(2, c.offset)
+			t.structField(3)
+			t.i32(1, parquetTypes[c.column.Type].physical)
+			t.list(2, thriftI32, 2)
+			t.varint(encodingPlain)
+			t.varint(encodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.bytes(c.column.Name)
+			t.i32(4, codecGzip)
+			t.i64(5, c.values)
+			t.i64(6, c.uncompressedSize)
+			t.i64(7, c.compressedSize)
+			t.i64(9, c.offset)
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.endStruct()
+	}
+	t.str(6, "dynamotools")
+	t.endStruct()
+	return t.buf.Bytes()
+}
+
+// ReadParquetSchema reads the columns from the footer of a parquet file written by a parquet archive
+func ReadParquetSchema(r io.ReaderAt, size int64) ([]Column, error) {
+	tail := make([]byte, 8)
+	if size < 12 {
+		return nil, errors.New("too small to be a parquet file")
+	}
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	n := int64(binary.LittleEndian.Uint32(tail))
+	if string(tail[4:]) != parquetMagic || n > size-12 {
+		return nil, errors.New("not a parquet file")
+	}
+	footer := make([]byte, n)
+	if _, err := r.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+
+	t := &thriftReader{buf: footer}
+	var last int16
+	for {
+		id, typ, err := t.field(&last)
+		if err != nil {
+			return nil, err
+		}
+		if typ == 0 {
+			return nil, errors.New("parquet footer has no schema")
+		}
+		if id != 2 || typ != thriftList {
+			if err := t.skip(typ, false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		_, count, err := t.list()
+		if err != nil {
+			return nil, err
+		}
+		var columns []Column
+		for i := 0; i < count; i++ {
+			c, err := readSchemaElement(t)
+			if err != nil {
+				return nil, err
+			}
+			// the first element is the root of the schema rather than a column.
+			if i > 0 {
+				columns = append(columns, c)
+			}
+		}
+		return columns, nil
+	}
+}
+
+// readSchemaElement reads a SchemaElement and maps its physical type and its logical type, or else its converted
+// type, back to a column type
+func readSchemaElement(t *thriftReader) (Column, error) {
+	physical, converted := int64(-1), int64(-1)
+	var logical int16
+	var name string
+	var last int16
+	for {
+		id, typ, err := t.field(&last)
+		if err != nil {
+			return Column{}, err
+		}
+		if typ == 0 {
+			break
+		}
+		switch id {
+		case 1:
+			physical, err = t.varint()
+		case 4:
+			name, err = t.bytes()
+		case 6:
+			converted, err = t.varint()
+		case 10:
+			logical, err = readLogicalType(t)
+		default:
+			err = t.skip(typ, false)
+		}
+		if err != nil {
+			return Column{}, err
+		}
+	}
+	for column, pt := range parquetTypes {
+		if int64(pt.physical) != physical {
+			continue
+		}
+		if (logical != 0 && pt.logical == logical) || (logical == 0 && int64(pt.converted) == converted) {
+			return Column{Name: name, Type: column}, nil
+		}
+	}
+	// int64 columns of archives written before the converted type was set have neither.
+	if physical == parquetInt64 && logical == 0 && converted == -1 {
+		return Column{Name: name, Type: ColumnInt64}, nil
+	}
+	return Column{Name: name}, nil
+}
+
+// readLogicalType reads the LogicalType union and returns which of its fields is set. Integers other than signed
+// 64 bit ones do not map to a column type and are returned as 0.
+func readLogicalType(t *thriftReader) (int16, error) {
+	var logical int16
+	var last int16
+	for {
+		id, typ, err := t.field(&last)
+		if err != nil || typ == 0 {
+			return logical, err
+		}
+		if id != logicalInteger || typ != thriftStruct {
+			logical = id
+			if err := t.skip(typ, false); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		var bits int64
+		var signed bool
+		var ilast int16
+		for {
+			iid, ityp, err := t.field(&ilast)
+			if err != nil {
+				return 0, err
+			}
+			if ityp == 0 {
+				break
+			}
+			switch {
+			case iid == 1 && ityp == thriftByte:
+				var b byte
+				b, err = t.byte()
+				bits = int64(int8(b))
+			case iid == 2 && (ityp == thriftTrue || ityp == thriftFalse):
+				signed = ityp == thriftTrue
+			default:
+				err = t.skip(ityp, false)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		if bits == 64 && signed {
+			logical = logicalInteger
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// readThrift decodes a thrift compact struct into a map of field id to value, structs are maps and lists slices
+func readThrift(t *testing.T, r *thriftReader) map[int16]interface{} {
+	s := map[int16]interface{}{}
+	var last int16
+	for {
+		id, typ, err := r.field(&last)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ == 0 {
+			return s
+		}
+		s[id] = readThriftValue(t, r, typ, false)
+	}
+}
+
+func readThriftValue(t *testing.T, r *thriftReader, typ byte, inList bool) interface{} {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		if inList {
+			b, err := r.byte()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b == thriftTrue
+		}
+		return typ == thriftTrue
+	case thriftByte:
+		b, err := r.byte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int64(int8(b))
+	case thriftI16, thriftI32, thriftI64:
+		v, err := r.varint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	case thriftBinary:
+		v, err := r.bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	case thriftList, thriftSet:
+		elem, n, err := r.list()
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			l[i] = readThriftValue(t, r, elem, true)
+		}
+		return l
+	case thriftStruct:
+		return readThrift(t, r)
+	}
+	if err := r.skip(typ, inList); err != nil {
+		t.Fatal(err)
+	}
+	return nil
+}
+
+// readParquet decodes the items of a parquet file written by the encoder, a gzipped plain data page per column
+func readParquet(t *testing.T, data []byte) []map[string]interface{} {
+	schema, err := ReadParquetSchema(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := readThrift(t, &thriftReader{buf: data[len(data)-8-n : len(data)-8]})
+
+	var items []map[string]interface{}
+	for _, g := range footer[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		rows := make([]map[string]interface{}, group[3].(int64))
+		for i := range rows {
+			rows[i] = map[string]interface{}{}
+		}
+		for i, c := range group[1].([]interface{}) {
+			meta := c.(map[int16]interface{})[3].(map[int16]interface{})
+			offset := int(meta[9].(int64))
+			r := &thriftReader{buf: data[offset:]}
+			header := readThrift(t, r)
+			compressed := data[offset+r.pos : offset+r.pos+int(header[3].(int64))]
+			gz, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) != int(header[2].(int64)) {
+				t.Fatalf("page of %s is %d bytes, header says %d", schema[i].Name, len(page), header[2])
+			}
+			decodePage(t, page, schema[i], rows)
+		}
+		items = append(items, rows...)
+	}
+	return items
+}
+
+// decodePage reads the definition levels, a single bit packed run, and the plain values of the defined rows
+func decodePage(t *testing.T, page []byte, c Column, rows []map[string]interface{}) {
+	size := int(binary.LittleEndian.Uint32(page))
+	levels := page[4 : 4+size]
+	groups, n := binary.Uvarint(levels)
+	if groups&1 != 1 || int(groups>>1) != (len(rows)+7)/8 {
+		t.Fatalf("%s: unexpected definition level run header %d", c.Name, groups)
+	}
+	levels = levels[n:]
+	values := page[4+size:]
+
+	var bit int
+	for i, row := range rows {
+		if levels[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+		switch c.Type {
+		case ColumnString, ColumnJSON, ColumnBinary:
+			l := int(binary.LittleEndian.Uint32(values))
+			v := values[4 : 4+l]
+			values = values[4+l:]
+			if c.Type == ColumnBinary {
+				row[c.Name] = v
+			} else {
+				row[c.Name] = string(v)
+			}
+		case ColumnInt64:
+			row[c.Name] = int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case ColumnDouble:
+			row[c.Name] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case ColumnBoolean:
+			row[c.Name] = values[bit/8]&(1<<uint(bit%8)) != 0
+			bit++
+		}
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	schema := []Column{
+		{"id", ColumnString}, {"n", ColumnInt64}, {"d", ColumnDouble}, {"ok", ColumnBoolean}, {"b", ColumnBinary}, {"j", ColumnJSON},
+	}
+	items := []map[string]interface{}{
+		{"id": "a", "n": 1.0, "d": 1.5, "ok": true, "b": []byte("x"), "j": map[string]interface{}{"k": "v"}},
+		{"id": "b", "ok": false, "n": 1.5},
+		{"n": -7.0, "d": 2.25, "ok": true, "j": []interface{}{1.0}},
+	}
+	// 1.5 is not an int64, so it is written as null.
+	want := []map[string]interface{}{
+		{"id": "a", "n": int64(1), "d": 1.5, "ok": true, "b": []byte("x"), "j": `{"k":"v"}`},
+		{"id": "b", "ok": false},
+		{"n": int64(-7), "d": 2.25, "ok": true, "j": "[1]"},
+	}
+
+	for _, groupSize := range []int{1, 2, 10} {
+		f, err := lookupFormat(FormatParquet, &EncodeOptions{Schema: schema, RowGroupItems: groupSize})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		e := f.newEncoder(&buf)
+		if err := e.encode(items); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ReadParquetSchema(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, schema) {
+			t.Errorf("row groups of %d: read schema %v, want %v", groupSize, got, schema)
+		}
+		if rows := readParquet(t, buf.Bytes()); !reflect.DeepEqual(rows, want) {
+			t.Errorf("row groups of %d: read %v, want %v", groupSize, rows, want)
+		}
+	}
+}
+
+// testdata/reference.parquet was written by parquet-go with gzip, statistics and the logical and converted types
+func TestReadParquetSchemaReference(t *testing.T) {
+	f, err := os.Open("testdata/reference.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadParquetSchema(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{"b", ColumnBinary}, {"created", ""}, {"d", ColumnDouble}, {"id", ColumnString},
+		{"j", ColumnJSON}, {"n", ColumnInt64}, {"ok", ColumnBoolean}, {"small", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+}
+
+func TestReadParquetSchemaInvalid(t *testing.T) {
+	for _, data := range []string{"", "PAR1", "PAR1\x00\x00\x00\x00PAR2", "PAR1\xff\x00\x00\x00PAR1"} {
+		if _, err := ReadParquetSchema(bytes.NewReader([]byte(data)), int64(len(data))); err == nil {
+			t.Errorf("read a schema from %q", data)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// pageWriter receives the pages of items produced by the scanner
+type pageWriter interface {
+	WritePage(items []map[string]interface{}) error
+	Close() error
+}
+
+// partWriter uploads pages of items to the bucket, rolling over to a new part object whenever the current
+// one reaches the size or item limit. Pages are never split so every part can be decoded on its own.
+type partWriter struct {
+	mu       sync.Mutex
+	uploader *s3manager.Uploader
+	bucket   string
+	baseKey  string
+	format   *format
+	maxBytes int64
+	maxItems int64
+	// folder puts the parts under <baseKey>/ even without limits
+	folder  bool
+	current *partUpload
+	parts   []manifest.Part
+}
+
+type partUpload struct {
+	part   manifest.Part
+	w      *io.PipeWriter
+	hash   hash.Hash
+	enc    pageEncoder
+	result chan error
+}
+
+// Write sends the encoded data to the upload, keeping track of its size and checksum
+func (pu *partUpload) Write(p []byte) (int, error) {
+	n, err := pu.w.Write(p)
+	pu.hash.Write(p[:n])
+	pu.part.Bytes += int64(n)
+	return n, err
+}
+
+// newPartWriter creates a part writer for the archive at baseKey (without an extension). With no limits
+// everything goes to a single <baseKey>.json object, otherwise to <baseKey>/part-00001.json and so on, with the
+// extension of the format.
+func newPartWriter(uploader *s3manager.Uploader, bucket, baseKey string, f *format, maxBytes, maxItems int64) *partWriter {
+	return &partWriter{
+		uploader: uploader,
+		bucket:   bucket,
+		baseKey:  baseKey,
+		format:   f,
+		maxBytes: maxBytes,
+		maxItems: maxItems,
+	}
+}
+
+func (pw *partWriter) split() bool {
+	return pw.maxBytes > 0 || pw.maxItems > 0 || pw.folder
+}
+
+func (pw *partWriter) WritePage(items []map[string]interface{}) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.current == nil {
+		pw.open()
+	}
+	if err := pw.current.enc.encode(items); err != nil {
+		return err
+	}
+	pw.current.part.Items += int64(len(items))
+
+	if (pw.maxBytes > 0 && pw.current.part.Bytes >= pw.maxBytes) ||
+		(pw.maxItems > 0 && pw.current.part.Items >= pw.maxItems) {
+		return pw.finish()
+	}
+	return nil
+}
+
+// Close finishes the last part, an empty table still gets a single empty part
+func (pw *partWriter) Close() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.current == nil && len(pw.parts) == 0 {
+		pw.open()
+	}
+	if pw.current != nil {
+		return pw.finish()
+	}
+	return nil
+}
+
+// Flush finishes the part being written if there is one, the next page starts a new part
+func (pw *partWriter) Flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.current != nil {
+		return pw.finish()
+	}
+	return nil
+}
+
+// Parts returns the parts which have been uploaded
+func (pw *partWriter) Parts() []manifest.Part {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.parts
+}
+
+func (pw *partWriter) open() {
+	key := pw.baseKey + pw.format.ext
+	if pw.split() {
+		key = fmt.Sprintf("%s/part-%05d%s", pw.baseKey, len(pw.parts)+1, pw.format.ext)
+	}
+	r, w := io.Pipe()
+	pu := &partUpload{
+		part:   manifest.Part{Key: key},
+		w:      w,
+		hash:   sha256.New(),
+		result: make(chan error, 1),
+	}
+	pu.enc = pw.format.newEncoder(pu)
+	log.Printf("backing up data in %s", key)
+	go func() {
+		_, err := pw.uploader.Upload(&s3manager.UploadInput{
+			Bucket:      &pw.bucket,
+			Key:         aws.String(key),
+			Body:        r,
+			ContentType: aws.String(pw.format.contentType),
+		})
+		// unblock the writer if the upload gave up part way through.
+		r.CloseWithError(err)
+		pu.result <- err
+	}()
+	pw.current = pu
+}
+
+// finish closes the current part and waits for its upload to complete
+func (pw *partWriter) finish() error {
+	pu := pw.current
+	pw.current = nil
+	if err := pu.enc.close(); err != nil {
+		pu.w.CloseWithError(err)
+		<-pu.result
+		return err
+	}
+	pu.w.Close()
+	if err := <-pu.result; err != nil {
+		log.Printf("error %s whilst uploading %s to s3", err, pu.part.Key)
+		return err
+	}
+	pu.part.SHA256 = hex.EncodeToString(pu.hash.Sum(nil))
+	pw.parts = append(pw.parts, pu.part)
+	return nil
+}
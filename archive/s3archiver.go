@@ -2,15 +2,20 @@ package archive
 
 import (
 	"fmt"
-	"io"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/defaults"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/transform"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
@@ -29,58 +34,233 @@ type S3ArchiveConfig struct {
 	UploadChunkSize   int64
 	UploadConcurrency int
 	BackupPrefix      string
+	TransformFile     string
+	Where             string
+	Select            string
+	PartSize          int64
+	PartItems         int64
+	Format            string
+	PerSegment        bool
+	Retry             string
+	RetrySegments     string
+	Columns           string
+	Flatten           string
+	NoHeader          bool
+	SchemaFile        string
+	Sample            int
+	RowGroupItems     int
+	PartitionBy       string
+	MaxOpenPartitions int
 }
 
 // ToS3 archives the dyanamo table to a file in s3 bucket
 func ToS3(c *S3ArchiveConfig) error {
-	s := getNewAwsSession(c.Region)
+	_, err := archiveTable(c, generateBackupKey(c.BackupPrefix, c.TableName))
+	return err
+}
 
-	db := dynamodb.New(s)
+// archiveTable archives the table to baseKey and returns the key of its manifest
+func archiveTable(c *S3ArchiveConfig, baseKey string) (string, error) {
+	cfg := newScannerConfig(c.TableName, c.TableIndex, c.ScanPartitions, c.ScanLimit,
+		c.ScanFilterName, c.ScanFilterType, c.ScanFilterOpertor, c.ScanFilterValue)
+	if c.TransformFile != "" {
+		t, err := transform.Load(c.TransformFile)
+		if err != nil {
+			return "", err
+		}
+		cfg.transform = t
+	}
+	f, err := filter.New(c.Where, c.Select)
+	if err != nil {
+		return "", err
+	}
+	cfg.filter = f
 
-	sc := newParallelScanner(db, newScannerConfig(c.TableName, c.TableIndex, c.ScanPartitions, c.ScanLimit,
-		c.ScanFilterName, c.ScanFilterType, c.ScanFilterOpertor, c.ScanFilterValue))
+	s := awssession.New(c.Region)
 
-	r, w := io.Pipe()
+	db := dynamodb.New(s)
+
+	sc := newParallelScanner(db, cfg)
 
 	u := s3manager.NewUploader(s, func(ul *s3manager.Uploader) {
 		ul.PartSize = c.UploadChunkSize * 1024 * 1024 //MB
 		ul.Concurrency = c.UploadConcurrency
 	})
 
-	go func() {
-		if err := sc.Scan(w); err != nil {
-			w.Close()
-			log.Fatal(err)
+	var previous *manifest.Manifest
+	if c.Retry != "" {
+		if previous, cfg.segments, err = retrySegments(s3.New(s), c); err != nil {
+			return "", err
+		}
+		cfg.partitions = c.ScanPartitions
+		baseKey = manifest.BaseKey(c.Retry)
+		c.Format = previous.Format
+	}
+	var schema []Column
+	if c.SchemaFile != "" {
+		if schema, err = LoadSchema(c.SchemaFile); err != nil {
+			return "", err
 		}
-	}()
+	}
+	af, err := lookupFormat(c.Format, &EncodeOptions{
+		Columns:       splitColumns(c.Columns),
+		Flatten:       c.Flatten,
+		NoHeader:      c.NoHeader,
+		Schema:        schema,
+		Sample:        c.Sample,
+		RowGroupItems: c.RowGroupItems,
+	})
+	if err != nil {
+		return "", err
+	}
 
-	key := generateBackupFileName(c.BackupPrefix, c.TableName)
-	log.Printf("backing up data in %s", key)
+	var out output
+	var partitioned *partitionedOutput
+	if c.PartitionBy != "" {
+		if c.PerSegment || previous != nil {
+			return "", fmt.Errorf("partitioned archives can not be written per segment or retried")
+		}
+		p, err := parseHivePartitioner(c.PartitionBy)
+		if err != nil {
+			return "", err
+		}
+		partitioned = newPartitionedOutput(u, c.UploadBucket, baseKey, af, c.PartSize*1024*1024, c.PartItems, p, c.MaxOpenPartitions)
+		out = partitioned
+	} else if c.PerSegment || previous != nil {
+		so := newSegmentOutput(u, c.UploadBucket, baseKey, af, c.PartSize*1024*1024, c.PartItems)
+		if previous != nil {
+			if err := so.clear(cfg.segments); err != nil {
+				return "", err
+			}
+		}
+		out = so
+	} else {
+		out = newSharedOutput(u, c.UploadBucket, baseKey, af, c.PartSize*1024*1024, c.PartItems)
+	}
 
-	_, err := u.Upload(&s3manager.UploadInput{
-		Bucket:      &c.UploadBucket,
-		Key:         aws.String(key),
-		Body:        r,
-		ContentType: aws.String("application/json"),
-	})
+	m := &manifest.Manifest{
+		Table:     c.TableName,
+		Kind:      manifest.KindFull,
+		Format:    af.name,
+		StartedAt: time.Now().UTC(),
+	}
+	if c.PerSegment {
+		m.Segments = c.ScanPartitions
+	}
+	err = sc.Scan(out)
 	if err != nil {
-		log.Printf("error %s whilst uploading to s3", err)
-		return err
+		out.close()
+	}
+	m.CompletedAt = time.Now().UTC()
+	m.Parts = out.parts()
+	m.FailedSegments = out.failedSegments()
+	if partitioned != nil {
+		m.PartitionBy = c.PartitionBy
+		m.Partitions = partitioned.partitions()
+	}
+	if previous != nil {
+		m = mergeRetry(previous, m, cfg.segments)
 	}
-	log.Println("Backup Completed!")
-	return nil
+	if err == nil && len(m.FailedSegments) != 0 {
+		err = fmt.Errorf("%d segments failed", len(m.FailedSegments))
+	}
+	if err != nil {
+		m.Status = manifest.StatusFailed
+		if merr := manifest.Write(s3.New(s), c.UploadBucket, manifest.Key(baseKey), m); merr != nil {
+			log.Printf("error %s whilst writing the manifest", merr)
+			return "", err
+		}
+		return manifest.Key(baseKey), err
+	}
+
+	m.Status = manifest.StatusComplete
+	if err := manifest.Write(s3.New(s), c.UploadBucket, manifest.Key(baseKey), m); err != nil {
+		log.Printf("error %s whilst writing the manifest", err)
+		return "", err
+	}
+	log.Printf("Backup Completed! %d parts listed in %s", len(m.Parts), manifest.Key(baseKey))
+	return manifest.Key(baseKey), nil
 }
 
-func generateBackupFileName(prefix, fileName string) string {
+// retrySegments reads the manifest of a per segment archive and works out which of its segments to scan again
+func retrySegments(svc s3iface.S3API, c *S3ArchiveConfig) (*manifest.Manifest, []int, error) {
+	m, err := manifest.Read(svc, c.UploadBucket, c.Retry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.Segments == 0 {
+		return nil, nil, fmt.Errorf("%s is not a per segment archive", c.Retry)
+	}
+	if m.Table != c.TableName {
+		return nil, nil, fmt.Errorf("%s is an archive of %s, not %s", c.Retry, m.Table, c.TableName)
+	}
+
+	segments := m.FailedSegments
+	if c.RetrySegments != "" {
+		segments = nil
+		for _, v := range strings.Split(c.RetrySegments, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || n < 0 || n >= m.Segments {
+				return nil, nil, fmt.Errorf("invalid segment %q, the archive has %d segments", v, m.Segments)
+			}
+			segments = append(segments, n)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, nil, fmt.Errorf("%s has no failed segments to retry", c.Retry)
+	}
+
+	// the segments only line up if the table is scanned with the same number of them.
+	c.ScanPartitions = m.Segments
+	log.Printf("retrying segments %v of %s", segments, c.Retry)
+	return m, segments, nil
+}
+
+// mergeRetry replaces the parts and failures of the retried segments in the previous manifest
+func mergeRetry(previous, retried *manifest.Manifest, segments []int) *manifest.Manifest {
+	retriedSet := map[int]bool{}
+	for _, n := range segments {
+		retriedSet[n] = true
+	}
+
+	m := *previous
+	m.CompletedAt = retried.CompletedAt
+	m.Parts = nil
+	for _, p := range previous.Parts {
+		if p.Segment == nil || !retriedSet[*p.Segment] {
+			m.Parts = append(m.Parts, p)
+		}
+	}
+	m.Parts = append(m.Parts, retried.Parts...)
+	sort.Sort(byKey(m.Parts))
+
+	m.FailedSegments = nil
+	for _, n := range previous.FailedSegments {
+		if !retriedSet[n] {
+			m.FailedSegments = append(m.FailedSegments, n)
+		}
+	}
+	m.FailedSegments = append(m.FailedSegments, retried.FailedSegments...)
+	sort.Ints(m.FailedSegments)
+	return &m
+}
+
+// generateBackupKey returns the key of the archive without the extension of its format
+func generateBackupKey(prefix, fileName string) string {
 	if prefix != "" {
-		return fmt.Sprintf("%s/%s/%s.json", prefix, time.Now().Format("2006-01-02"), fileName)
+		return fmt.Sprintf("%s/%s/%s", prefix, time.Now().Format("2006-01-02"), fileName)
 	}
 
-	return fmt.Sprintf("%s/%s.json", time.Now().Format("2006-01-02"), fileName)
+	return fmt.Sprintf("%s/%s", time.Now().Format("2006-01-02"), fileName)
 }
 
-func getNewAwsSession(region string) *session.Session {
-	awsconfig := defaults.Config().WithRegion(region) //.WithLogLevel(aws.LogDebugWithRequestErrors)
-	awsconfig.Credentials = defaults.CredChain(awsconfig, defaults.Handlers())
-	return session.New(awsconfig)
+// splitColumns splits a comma separated list of columns, an empty list gives no columns
+func splitColumns(columns string) []string {
+	var names []string
+	for _, name := range strings.Split(columns, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
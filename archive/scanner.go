@@ -2,11 +2,15 @@ package archive
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"strings"
 
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/transform"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -15,7 +19,7 @@ import (
 )
 
 type scanner interface {
-	Scan(writer io.WriteCloser) error
+	Scan(out output) error
 }
 
 type parallelScanner struct {
@@ -32,6 +36,16 @@ type scannerConfig struct {
 	filterAttributeType string
 	filterOperator      string
 	filterValue         string
+	filter              *filter.Filter
+	transform           *transform.Transformer
+	segments            []int
+	limiter             *ratelimit.Limiter
+	keyCondition        string
+	names               map[string]*string
+	values              map[string]*dynamodb.AttributeValue
+	attributes          []string
+	progress            ScanProgress
+	lossless            bool
 }
 
 func newScannerConfig(tableName, index string, partitions, limit int, filterAttribute, filterAttributeType, filterOperator, filterValue string) *scannerConfig {
@@ -41,66 +55,263 @@ func newScannerConfig(tableName, index string, partitions, limit int, filterAttr
 }
 
 func newParallelScanner(db dynamodbiface.DynamoDBAPI, cfg *scannerConfig) scanner {
-	return &parallelScanner{db, cfg}
+	return &parallelScanner{db: db, cfg: cfg}
 }
 
-func (s *parallelScanner) Scan(writer io.WriteCloser) error {
+// ScanTable scans the table in parallel segments the same way an archive does, calling fn with every page
+// of items. fn is called from every segment at once.
+func ScanTable(db dynamodbiface.DynamoDBAPI, table string, segments, limit int, fn func(items []map[string]interface{}) error) error {
+	return Scan(db, &ScanConfig{TableName: table, Segments: segments, Limit: limit}, fn)
+}
+
+// ScanConfig configures a scan which hands its pages to a function rather than writing an archive
+type ScanConfig struct {
+	TableName string
+	Segments  int
+	Limit     int
+	// KeyCondition queries the table instead of scanning it, with the Names and Values of its placeholders
+	KeyCondition string
+	Names        map[string]*string
+	Values       map[string]*dynamodb.AttributeValue
+	// Attributes are read instead of the whole item when given
+	Attributes []string
+	Filter     *filter.Filter
+	Transform  *transform.Transformer
+	// Limiter is shared by the segments to keep the read capacity they consume under its rate
+	Limiter *ratelimit.Limiter
+	// Progress continues the segments of an earlier run and is moved on once fn has returned for a page
+	Progress ScanProgress
+	// Lossless decodes the items like a restore does, sets stay sets and numbers keep all their digits, for
+	// items which are written back to dynamo rather than to an archive
+	Lossless bool
+}
+
+// ScanProgress is where each segment of a scan continues from, so a run which failed can be resumed
+type ScanProgress interface {
+	// Start returns the key the segment continues from, and whether it is already done
+	Start(segment int) (map[string]*dynamodb.AttributeValue, bool)
+	// Advance records that the items of the segment before the key have been handled, an empty key ends it
+	Advance(segment, handled int, key map[string]*dynamodb.AttributeValue)
+}
+
+// Scan scans the table in parallel segments like ScanTable, or queries it with the key condition, filtering and
+// transforming the items of every page before calling fn with them.
+func Scan(db dynamodbiface.DynamoDBAPI, c *ScanConfig, fn func(items []map[string]interface{}) error) error {
+	return scanTo(db, c, c.Lossless, pageFunc(fn))
+}
+
+// ScanAttributes is Scan handing fn the attribute values dynamo returned for each item alongside it, so keys and
+// values can be sent back exactly as they were read. The items are decoded losslessly, the attribute values are
+// those of the items before they were transformed.
+func ScanAttributes(db dynamodbiface.DynamoDBAPI, c *ScanConfig, fn func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error) error {
+	return scanTo(db, c, true, attributesFunc(fn))
+}
+
+func scanTo(db dynamodbiface.DynamoDBAPI, c *ScanConfig, lossless bool, out output) error {
+	segments := c.Segments
+	if c.KeyCondition != "" || segments < 1 {
+		segments = 1
+	}
+	cfg := newScannerConfig(c.TableName, "", segments, c.Limit, "", "", "", "")
+	cfg.filter, cfg.transform, cfg.limiter = c.Filter, c.Transform, c.Limiter
+	cfg.keyCondition, cfg.names, cfg.values = c.KeyCondition, c.Names, c.Values
+	cfg.attributes, cfg.progress, cfg.lossless = c.Attributes, c.Progress, lossless
+	return newParallelScanner(db, cfg).Scan(out)
+}
+
+// pageFunc is an output which hands every page to a function instead of writing it anywhere
+type pageFunc func(items []map[string]interface{}) error
+
+func (f pageFunc) WritePage(items []map[string]interface{}) error { return f(items) }
+func (f pageFunc) Close() error                                   { return nil }
+func (f pageFunc) segment(n int) pageWriter                       { return f }
+func (f pageFunc) segmentDone(n int, err error) error             { return err }
+func (f pageFunc) close() error                                   { return nil }
+func (f pageFunc) parts() []manifest.Part                         { return nil }
+func (f pageFunc) failedSegments() []int                          { return nil }
+
+// attributesFunc is a pageFunc which is handed the attribute values of the items too
+type attributesFunc func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error
+
+func (f attributesFunc) WritePage(items []map[string]interface{}) error { return f(items, nil) }
+func (f attributesFunc) writeAttributes(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error {
+	return f(items, attrs)
+}
+func (f attributesFunc) Close() error                       { return nil }
+func (f attributesFunc) segment(n int) pageWriter           { return f }
+func (f attributesFunc) segmentDone(n int, err error) error { return err }
+func (f attributesFunc) close() error                       { return nil }
+func (f attributesFunc) parts() []manifest.Part             { return nil }
+func (f attributesFunc) failedSegments() []int              { return nil }
+
+// attributesWriter is a page writer which takes the attribute values of the items as well
+type attributesWriter interface {
+	writeAttributes(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error
+}
+
+func (s *parallelScanner) Scan(out output) error {
 	grp, _ := errgroup.WithContext(context.Background())
 
-	log.Printf("started processing %d partitions....", s.cfg.partitions)
+	segments := s.cfg.segments
+	if segments == nil {
+		for index := 0; index < s.cfg.partitions; index++ {
+			segments = append(segments, index)
+		}
+	}
+	log.Printf("started processing %d of %d partitions....", len(segments), s.cfg.partitions)
 
-	for index := 0; index < s.cfg.partitions; index++ {
+	for _, index := range segments {
 		partitionSegment := index
 		grp.Go(func() error {
-			if err := s.db.ScanPages(s.buildScanInput(partitionSegment), func(p *dynamodb.ScanOutput, lastPage bool) (shouldContinue bool) {
-				items := make([]*dynamodb.AttributeValue, len(p.Items))
-				for i, m := range p.Items {
-					items[i] = &dynamodb.AttributeValue{M: m}
-				}
-				var decodedItems []map[string]interface{}
-				if err := dynamodbattribute.NewDecoder().Decode(&dynamodb.AttributeValue{L: items}, &decodedItems); err != nil {
-					log.Printf("error %s whilst decoding items %v", err, items)
-				}
-				if decodedItems != nil {
-					if err := json.NewEncoder(writer).Encode(decodedItems); err != nil {
-						log.Printf("error %s whilst encoding items %v", err, items)
-					}
-				}
-				return !lastPage
-			}); err != nil {
-				log.Printf("error %s whilst scanning items from dynamo partion %d", err, partitionSegment)
-				return err
-			}
-			log.Println("finished processing partion no ", partitionSegment)
-			return nil
+			return out.segmentDone(partitionSegment, s.scanSegment(partitionSegment, out.segment(partitionSegment)))
 		})
 	}
 	if err := grp.Wait(); err != nil {
 		return err
 	}
-	if err := writer.Close(); err != nil {
+	if err := out.close(); err != nil {
 		log.Printf("error %s whilst closing the writer", err)
 		return err
 	}
 
-	log.Printf("finished processing %d partitions", s.cfg.partitions)
+	log.Printf("finished processing %d partitions", len(segments))
 	return nil
 }
 
+func (s *parallelScanner) scanSegment(partitionSegment int, writer pageWriter) error {
+	var startKey map[string]*dynamodb.AttributeValue
+	if s.cfg.progress != nil {
+		var done bool
+		if startKey, done = s.cfg.progress.Start(partitionSegment); done {
+			return nil
+		}
+	}
+	var werr error
+	page := func(pageItems []map[string]*dynamodb.AttributeValue, consumed *dynamodb.ConsumedCapacity, lastKey map[string]*dynamodb.AttributeValue, lastPage bool) bool {
+		decodedItems, attrs := s.decodeItems(pageItems)
+		decodedItems, attrs = s.processItems(decodedItems, attrs)
+		if decodedItems != nil {
+			if aw, ok := writer.(attributesWriter); ok {
+				werr = aw.writeAttributes(decodedItems, attrs)
+			} else {
+				werr = writer.WritePage(decodedItems)
+			}
+			if werr != nil {
+				log.Printf("error %s whilst writing items %v", werr, pageItems)
+				return false
+			}
+		}
+		if s.cfg.progress != nil {
+			s.cfg.progress.Advance(partitionSegment, len(decodedItems), lastKey)
+		}
+		if consumed != nil {
+			s.cfg.limiter.Wait(aws.Float64Value(consumed.CapacityUnits))
+		}
+		return !lastPage
+	}
+	var err error
+	if s.cfg.keyCondition != "" {
+		err = s.db.QueryPages(s.buildQueryInput(startKey), func(p *dynamodb.QueryOutput, lastPage bool) bool {
+			return page(p.Items, p.ConsumedCapacity, p.LastEvaluatedKey, lastPage)
+		})
+	} else {
+		input := s.buildScanInput(partitionSegment)
+		input.ExclusiveStartKey = startKey
+		err = s.db.ScanPages(input, func(p *dynamodb.ScanOutput, lastPage bool) bool {
+			return page(p.Items, p.ConsumedCapacity, p.LastEvaluatedKey, lastPage)
+		})
+	}
+	if err != nil {
+		log.Printf("error %s whilst scanning items from dynamo partion %d", err, partitionSegment)
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	log.Println("finished processing partion no ", partitionSegment)
+	return nil
+}
+
+// decodeItems decodes the items of a page, losslessly when configured, leaving out any which can not be decoded.
+// A lossless decode also returns the attribute values of the items it kept.
+func (s *parallelScanner) decodeItems(pageItems []map[string]*dynamodb.AttributeValue) ([]map[string]interface{}, []map[string]*dynamodb.AttributeValue) {
+	if !s.cfg.lossless {
+		items := make([]*dynamodb.AttributeValue, len(pageItems))
+		for i, m := range pageItems {
+			items[i] = &dynamodb.AttributeValue{M: m}
+		}
+		var decodedItems []map[string]interface{}
+		if err := dynamodbattribute.NewDecoder().Decode(&dynamodb.AttributeValue{L: items}, &decodedItems); err != nil {
+			log.Printf("error %s whilst decoding items %v", err, items)
+		}
+		return decodedItems, nil
+	}
+	var decodedItems []map[string]interface{}
+	var attrs []map[string]*dynamodb.AttributeValue
+	for _, m := range pageItems {
+		item, err := source.ItemFromAttributes(m)
+		if err != nil {
+			log.Printf("error %s whilst decoding item %v, skipping it", err, m)
+			continue
+		}
+		decodedItems = append(decodedItems, item)
+		attrs = append(attrs, m)
+	}
+	return decodedItems, attrs
+}
+
+// processItems filters and transforms the decoded items of a page, skipping the ones which fail. The attribute
+// values of the kept items are returned with them when there are any.
+func (s *parallelScanner) processItems(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) ([]map[string]interface{}, []map[string]*dynamodb.AttributeValue) {
+	if s.cfg.filter == nil && s.cfg.transform == nil {
+		return items, attrs
+	}
+	var processed []map[string]interface{}
+	var kept []map[string]*dynamodb.AttributeValue
+	for i, item := range items {
+		item, ok, err := s.cfg.filter.Apply(item)
+		if err != nil {
+			log.Printf("error %s whilst filtering item, skipping it", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if item, err = s.cfg.transform.Apply(item); err != nil {
+			log.Printf("error %s whilst transforming item, skipping it", err)
+			continue
+		}
+		processed = append(processed, item)
+		if attrs != nil {
+			kept = append(kept, attrs[i])
+		}
+	}
+	return processed, kept
+}
+
 func (s *parallelScanner) buildScanInput(partitionIndex int) *dynamodb.ScanInput {
 	input := &dynamodb.ScanInput{
 		TableName:     aws.String(s.cfg.tableName),
 		Segment:       aws.Int64(int64(partitionIndex)),
 		TotalSegments: aws.Int64(int64(s.cfg.partitions)),
-		Limit:         aws.Int64(int64(s.cfg.limit)),
+	}
+	if s.cfg.limit > 0 {
+		input.Limit = aws.Int64(int64(s.cfg.limit))
+	}
+	if s.cfg.limiter != nil {
+		input.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
 	}
 	if s.cfg.index != "" {
 		input.IndexName = aws.String(s.cfg.index)
 	}
+	input.ProjectionExpression, input.ExpressionAttributeNames = s.projection()
 
 	if s.cfg.filterAttribute != "" && s.cfg.filterAttributeType != "" && s.cfg.filterOperator != "" && s.cfg.filterValue != "" {
 		input.FilterExpression = aws.String(fmt.Sprintf("#name %s :val", s.cfg.filterOperator))
-		input.ExpressionAttributeNames = map[string]*string{"#name": &s.cfg.filterAttribute}
+		if input.ExpressionAttributeNames == nil {
+			input.ExpressionAttributeNames = map[string]*string{}
+		}
+		input.ExpressionAttributeNames["#name"] = &s.cfg.filterAttribute
 		if s.cfg.filterAttributeType == "string" {
 			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":val": &dynamodb.AttributeValue{S: aws.String(s.cfg.filterValue)}}
 		} else if s.cfg.filterAttributeType == "number" {
@@ -110,3 +321,45 @@ func (s *parallelScanner) buildScanInput(partitionIndex int) *dynamodb.ScanInput
 
 	return input
 }
+
+func (s *parallelScanner) buildQueryInput(startKey map[string]*dynamodb.AttributeValue) *dynamodb.QueryInput {
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(s.cfg.tableName),
+		KeyConditionExpression:    aws.String(s.cfg.keyCondition),
+		ExpressionAttributeValues: s.cfg.values,
+		ExclusiveStartKey:         startKey,
+	}
+	if s.cfg.limit > 0 {
+		input.Limit = aws.Int64(int64(s.cfg.limit))
+	}
+	if s.cfg.limiter != nil {
+		input.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+	}
+	if s.cfg.index != "" {
+		input.IndexName = aws.String(s.cfg.index)
+	}
+	input.ProjectionExpression, input.ExpressionAttributeNames = s.projection()
+	for k, v := range s.cfg.names {
+		if input.ExpressionAttributeNames == nil {
+			input.ExpressionAttributeNames = map[string]*string{}
+		}
+		input.ExpressionAttributeNames[k] = v
+	}
+	return input
+}
+
+// projection returns the projection expression and its names reading only the configured attributes, or nils to
+// read whole items
+func (s *parallelScanner) projection() (*string, map[string]*string) {
+	if len(s.cfg.attributes) == 0 {
+		return nil, nil
+	}
+	names := map[string]*string{}
+	var placeholders []string
+	for i, a := range s.cfg.attributes {
+		name := fmt.Sprintf("#p%d", i)
+		names[name] = aws.String(a)
+		placeholders = append(placeholders, name)
+	}
+	return aws.String(strings.Join(placeholders, ", ")), names
+}
@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// pagesDB returns two pages from every scan or query, the second ending the segment
+type pagesDB struct {
+	dynamodbiface.DynamoDBAPI
+	mu      sync.Mutex
+	scans   []*dynamodb.ScanInput
+	queries []*dynamodb.QueryInput
+}
+
+func idKey(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}}
+}
+
+func (db *pagesDB) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	db.mu.Lock()
+	db.scans = append(db.scans, in)
+	db.mu.Unlock()
+	segment := string('a' + byte(aws.Int64Value(in.Segment)))
+	if fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{idKey(segment + "1")}, LastEvaluatedKey: idKey(segment + "1")}, false) {
+		fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{idKey(segment + "2")}}, true)
+	}
+	return nil
+}
+
+func (db *pagesDB) QueryPages(in *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	db.mu.Lock()
+	db.queries = append(db.queries, in)
+	db.mu.Unlock()
+	if fn(&dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{idKey("q1")}, LastEvaluatedKey: idKey("q1")}, false) {
+		fn(&dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{idKey("q2")}}, true)
+	}
+	return nil
+}
+
+// fakeProgress records the progress of each segment in memory
+type fakeProgress struct {
+	mu       sync.Mutex
+	start    map[int]map[string]*dynamodb.AttributeValue
+	done     map[int]bool
+	handled  int
+	advanced map[int]int
+}
+
+func (p *fakeProgress) Start(segment int) (map[string]*dynamodb.AttributeValue, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.start[segment], p.done[segment]
+}
+
+func (p *fakeProgress) Advance(segment, handled int, key map[string]*dynamodb.AttributeValue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handled += handled
+	p.advanced[segment]++
+	p.done[segment] = len(key) == 0
+}
+
+func TestScanProgress(t *testing.T) {
+	db := &pagesDB{}
+	p := &fakeProgress{
+		start:    map[int]map[string]*dynamodb.AttributeValue{1: idKey("b1")},
+		done:     map[int]bool{0: true},
+		advanced: map[int]int{},
+	}
+	var mu sync.Mutex
+	var items int
+	err := Scan(db, &ScanConfig{TableName: "jobs", Segments: 3, Attributes: []string{"id"}, Progress: p}, func(page []map[string]interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		items += len(page)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.scans) != 2 {
+		t.Fatalf("scanned %d segments, want the 2 which were not done", len(db.scans))
+	}
+	for _, in := range db.scans {
+		segment := aws.Int64Value(in.Segment)
+		if segment == 1 && aws.StringValue(in.ExclusiveStartKey["id"].S) != "b1" {
+			t.Errorf("segment 1 started at %v, want b1", in.ExclusiveStartKey)
+		}
+		if aws.StringValue(in.ProjectionExpression) != "#p0" || aws.StringValue(in.ExpressionAttributeNames["#p0"]) != "id" {
+			t.Errorf("segment %d projected %v %v", segment, aws.StringValue(in.ProjectionExpression), in.ExpressionAttributeNames)
+		}
+	}
+	if items != 4 || p.handled != 4 || !p.done[1] || !p.done[2] || p.advanced[1] != 2 {
+		t.Errorf("handled %d items, progress %d %v %v", items, p.handled, p.done, p.advanced)
+	}
+}
+
+func TestScanKeyCondition(t *testing.T) {
+	db := &pagesDB{}
+	values := map[string]*dynamodb.AttributeValue{":id": {S: aws.String("42")}}
+	var items int
+	err := Scan(db, &ScanConfig{
+		TableName:    "jobs",
+		Segments:     4,
+		KeyCondition: "#advertiser = :id",
+		Names:        map[string]*string{"#advertiser": aws.String("advertiser")},
+		Values:       values,
+		Attributes:   []string{"id"},
+	}, func(page []map[string]interface{}) error {
+		items += len(page)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.scans) != 0 || len(db.queries) != 1 {
+		t.Fatalf("%d scans and %d queries, want a single query", len(db.scans), len(db.queries))
+	}
+	in := db.queries[0]
+	if aws.StringValue(in.KeyConditionExpression) != "#advertiser = :id" || in.ExpressionAttributeValues[":id"] != values[":id"] ||
+		len(in.ExpressionAttributeNames) != 2 || aws.StringValue(in.ProjectionExpression) != "#p0" {
+		t.Errorf("query %v", in)
+	}
+	if items != 2 {
+		t.Errorf("handled %d items, want 2", items)
+	}
+}
+
+func TestScanAttributes(t *testing.T) {
+	db := &pagesDB{}
+	f, err := filter.New("id != 'a1'", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	ids := map[string]string{}
+	err = ScanAttributes(db, &ScanConfig{TableName: "jobs", Segments: 2, Filter: f}, func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(items) != len(attrs) {
+			t.Errorf("%d items with %d attribute values", len(items), len(attrs))
+			return nil
+		}
+		for i, item := range items {
+			ids[item["id"].(string)] = aws.StringValue(attrs[i]["id"].S)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a2": "a2", "b1": "b1", "b2": "b2"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("items and attribute values %v, want %v", ids, want)
+	}
+}
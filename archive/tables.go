@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// ResolveTables expands the comma separated table names and glob patterns, e.g. jobs-*, into the tables of the
+// region. With a tag, key=value or just key, only the tables carrying it are kept, and no names means every table.
+func ResolveTables(region, names, tag string) ([]string, error) {
+	db := dynamodb.New(awssession.New(region))
+
+	var patterns []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			patterns = append(patterns, name)
+		}
+	}
+	if len(patterns) == 0 {
+		if tag == "" {
+			return nil, fmt.Errorf("no tables or tag given")
+		}
+		patterns = []string{"*"}
+	}
+
+	var all []string
+	seen := map[string]bool{}
+	var tables []string
+	for _, p := range patterns {
+		if !strings.ContainsAny(p, "*?[") {
+			if !seen[p] {
+				seen[p] = true
+				tables = append(tables, p)
+			}
+			continue
+		}
+		if all == nil {
+			err := db.ListTablesPages(&dynamodb.ListTablesInput{}, func(out *dynamodb.ListTablesOutput, lastPage bool) bool {
+				all = append(all, aws.StringValueSlice(out.TableNames)...)
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		matched := false
+		for _, t := range all {
+			ok, err := path.Match(p, t)
+			if err != nil {
+				return nil, fmt.Errorf("invalid table pattern %q: %v", p, err)
+			}
+			if ok {
+				matched = true
+				if !seen[t] {
+					seen[t] = true
+					tables = append(tables, t)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tables match %q", p)
+		}
+	}
+
+	if tag != "" {
+		var tagged []string
+		for _, t := range tables {
+			ok, err := hasTag(db, t, tag)
+			if err != nil {
+				return nil, fmt.Errorf("error %s whilst reading the tags of %s", err, t)
+			}
+			if ok {
+				tagged = append(tagged, t)
+			}
+		}
+		if len(tagged) == 0 {
+			return nil, fmt.Errorf("no tables have the tag %s", tag)
+		}
+		tables = tagged
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// hasTag reports whether the table has the tag, given as key=value or just key for any value
+func hasTag(db dynamodbiface.DynamoDBAPI, table, want string) (bool, error) {
+	key, value, anyValue := want, "", true
+	if i := strings.Index(want, "="); i >= 0 {
+		key, value, anyValue = want[:i], want[i+1:], false
+	}
+
+	desc, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return false, err
+	}
+	input := &dynamodb.ListTagsOfResourceInput{ResourceArn: desc.Table.TableArn}
+	for {
+		out, err := db.ListTagsOfResource(input)
+		if err != nil {
+			return false, err
+		}
+		for _, t := range out.Tags {
+			if aws.StringValue(t.Key) == key && (anyValue || aws.StringValue(t.Value) == value) {
+				return true, nil
+			}
+		}
+		if out.NextToken == nil {
+			return false, nil
+		}
+		input.NextToken = out.NextToken
+	}
+}
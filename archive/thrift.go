@@ -0,0 +1,249 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the thrift compact protocol structs of the parquet metadata
+type thriftWriter struct {
+	buf    bytes.Buffer
+	fields []int16
+}
+
+func (t *thriftWriter) beginStruct() {
+	t.fields = append(t.fields, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	t.fields = t.fields[:len(t.fields)-1]
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.fields[len(t.fields)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) i8(id int16, v int8) {
+	t.field(id, thriftByte)
+	t.buf.WriteByte(byte(v))
+}
+
+// boolean writes a bool field, its value is the type of the field header
+func (t *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.bytes(s)
+}
+
+// list writes the header of a list field, the n elements follow without field headers
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.uvarint(uint64(n))
+}
+
+// structField writes the header of a struct field and begins the struct
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.beginStruct()
+}
+
+func (t *thriftWriter) bytes(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// varint writes a zigzag encoded integer
+func (t *thriftWriter) varint(v int64) {
+	t.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftWriter) uvarint(v uint64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	t.buf.Write(b[:binary.PutUvarint(b, v)])
+}
+
+// more thrift compact protocol types, bools and bytes are written for logical types and the rest only skipped
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftDouble = 7
+	thriftSet    = 10
+	thriftMap    = 11
+)
+
+var errThriftShort = errors.New("thrift struct is cut short")
+
+// thriftReader reads the thrift compact protocol structs of the parquet metadata
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (t *thriftReader) byte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, errThriftShort
+	}
+	t.pos++
+	return t.buf[t.pos-1], nil
+}
+
+func (t *thriftReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, errThriftShort
+	}
+	t.pos += n
+	return v, nil
+}
+
+// varint reads a zigzag encoded integer
+func (t *thriftReader) varint() (int64, error) {
+	v, err := t.uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (t *thriftReader) bytes() (string, error) {
+	n, err := t.uvarint()
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(t.buf)-t.pos) < n {
+		return "", errThriftShort
+	}
+	t.pos += int(n)
+	return string(t.buf[t.pos-int(n) : t.pos]), nil
+}
+
+// field reads the header of the next field of a struct, a type of 0 marks the end of the struct
+func (t *thriftReader) field(last *int16) (int16, byte, error) {
+	b, err := t.byte()
+	if err != nil || b == 0 {
+		return 0, 0, err
+	}
+	if d := int16(b >> 4); d != 0 {
+		*last += d
+	} else {
+		id, err := t.varint()
+		if err != nil {
+			return 0, 0, err
+		}
+		*last = int16(id)
+	}
+	return *last, b & 0x0f, nil
+}
+
+// list reads the header of a list field, returning the type and number of its elements
+func (t *thriftReader) list() (byte, int, error) {
+	b, err := t.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	n := uint64(b >> 4)
+	if n == 15 {
+		if n, err = t.uvarint(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return b & 0x0f, int(n), nil
+}
+
+// skip reads past a value of the type, bools of a field are in its header but take a byte in a list
+func (t *thriftReader) skip(typ byte, inList bool) error {
+	var err error
+	switch typ {
+	case thriftTrue, thriftFalse:
+		if inList {
+			_, err = t.byte()
+		}
+	case thriftByte:
+		_, err = t.byte()
+	case thriftI16, thriftI32, thriftI64:
+		_, err = t.varint()
+	case thriftDouble:
+		if t.pos += 8; t.pos > len(t.buf) {
+			err = errThriftShort
+		}
+	case thriftBinary:
+		_, err = t.bytes()
+	case thriftList, thriftSet:
+		var elem byte
+		var n int
+		if elem, n, err = t.list(); err != nil {
+			return err
+		}
+		for i := 0; i < n && err == nil; i++ {
+			err = t.skip(elem, true)
+		}
+	case thriftMap:
+		var n uint64
+		if n, err = t.uvarint(); err != nil || n == 0 {
+			return err
+		}
+		var kv byte
+		if kv, err = t.byte(); err != nil {
+			return err
+		}
+		for i := uint64(0); i < n && err == nil; i++ {
+			if err = t.skip(kv>>4, true); err == nil {
+				err = t.skip(kv&0x0f, true)
+			}
+		}
+	case thriftStruct:
+		var last int16
+		for {
+			_, typ, ferr := t.field(&last)
+			if ferr != nil || typ == 0 {
+				return ferr
+			}
+			if err = t.skip(typ, false); err != nil {
+				return err
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown thrift type %d", typ)
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package awssession
+
+import (
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// New creates a session for the region with the default credential chain
+func New(region string) *session.Session {
+	awsconfig := defaults.Config().WithRegion(region)
+	awsconfig.Credentials = defaults.CredChain(awsconfig, defaults.Handlers())
+	return session.New(awsconfig)
+}
+
+// NewWithProfile creates a session for the region, with the shared config and credentials of the profile when
+// one is given, so profiles which assume a role or use sso work as they do for the aws cli
+func NewWithProfile(region, profile string) (*session.Session, error) {
+	if profile == "" {
+		return New(region), nil
+	}
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *defaults.Config().WithRegion(region),
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
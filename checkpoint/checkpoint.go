@@ -0,0 +1,54 @@
+package checkpoint
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// NewRunID returns a sortable id for a run, the time it started followed by random hex
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+// File is the checkpoint file of a run of the command, in the working directory
+func File(command, runID string) string {
+	return fmt.Sprintf("%s-%s.checkpoint.json", command, runID)
+}
+
+// Load reads the checkpoint of a run of the command into v
+func Load(command, runID string, v interface{}) error {
+	data, err := ioutil.ReadFile(File(command, runID))
+	if err != nil {
+		return fmt.Errorf("error %s whilst reading the checkpoint of run %s", err, runID)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error %s whilst reading the checkpoint of run %s", err, runID)
+	}
+	return nil
+}
+
+// Save writes the checkpoint of a run of the command
+func Save(command, runID string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// write and rename so a crash never leaves a partial checkpoint behind.
+	tmp := File(command, runID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, File(command, runID))
+}
+
+// Remove deletes the checkpoint once the run has completed
+func Remove(command, runID string) {
+	os.Remove(File(command, runID))
+}
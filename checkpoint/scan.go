@@ -0,0 +1,126 @@
+package checkpoint
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Interval is how often a checkpoint is saved at most as a run moves on
+const Interval = time.Second
+
+// Scan records how far a run over the items of a table has got. Every item of a segment before its start key has
+// been handled, and segments which are done have been handled completely.
+type Scan struct {
+	RunID     string                   `json:"runId"`
+	Command   string                   `json:"command"`
+	Table     string                   `json:"table"`
+	Operation string                   `json:"operation"`
+	Segments  int                      `json:"segments"`
+	Progress  map[int]*SegmentProgress `json:"progress"`
+	Handled   int64                    `json:"handled"`
+}
+
+// SegmentProgress is the key a segment continues scanning from
+type SegmentProgress struct {
+	StartKey map[string]*dynamodb.AttributeValue `json:"startKey,omitempty"`
+	Done     bool                                `json:"done"`
+}
+
+// NewScan starts a run of the command against the table. The operation describes which items the run handles and
+// what it does to them, a resumed run has to do the same.
+func NewScan(command, table, operation string, segments int) *Scan {
+	return &Scan{
+		RunID:     NewRunID(),
+		Command:   command,
+		Table:     table,
+		Operation: operation,
+		Segments:  segments,
+		Progress:  map[int]*SegmentProgress{},
+	}
+}
+
+// LoadScan reads the checkpoint of the run, which has to be of the same command, table, operation and segments
+func LoadScan(command, runID, table, operation string, segments int) (*Scan, error) {
+	s := &Scan{}
+	if err := Load(command, runID, s); err != nil {
+		return nil, err
+	}
+	if s.Table != table {
+		return nil, fmt.Errorf("run %s was against table %s, not %s", runID, s.Table, table)
+	}
+	if s.Operation != operation {
+		return nil, fmt.Errorf("run %s did %q, not %q", runID, s.Operation, operation)
+	}
+	if s.Segments != segments {
+		return nil, fmt.Errorf("run %s used %d segments, not %d", runID, s.Segments, segments)
+	}
+	if s.Progress == nil {
+		s.Progress = map[int]*SegmentProgress{}
+	}
+	return s, nil
+}
+
+// Tracker moves the scan on as the segments handle their pages and saves it at most once an Interval
+type Tracker struct {
+	mu       sync.Mutex
+	scan     *Scan
+	lastSave time.Time
+}
+
+// NewTracker tracks the progress of the scan
+func NewTracker(s *Scan) *Tracker {
+	return &Tracker{scan: s}
+}
+
+// RunID is the id to resume the run with
+func (t *Tracker) RunID() string {
+	return t.scan.RunID
+}
+
+// Start returns the key the segment continues from, and whether it is already done
+func (t *Tracker) Start(segment int) (map[string]*dynamodb.AttributeValue, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.scan.Progress[segment]
+	if !ok {
+		p = &SegmentProgress{}
+		t.scan.Progress[segment] = p
+	}
+	return p.StartKey, p.Done
+}
+
+// Advance records that every item of the segment before the key has been handled, an empty key ends the segment
+func (t *Tracker) Advance(segment, handled int, key map[string]*dynamodb.AttributeValue) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.scan.Progress[segment]
+	p.StartKey = key
+	p.Done = len(key) == 0
+	t.scan.Handled += int64(handled)
+	if time.Since(t.lastSave) > Interval {
+		t.save()
+	}
+}
+
+// Flush saves the checkpoint as it stands
+func (t *Tracker) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.save()
+}
+
+// Remove deletes the checkpoint once the run has completed
+func (t *Tracker) Remove() {
+	Remove(t.scan.Command, t.scan.RunID)
+}
+
+func (t *Tracker) save() {
+	t.lastSave = time.Now()
+	if err := Save(t.scan.Command, t.scan.RunID, t.scan); err != nil {
+		log.Printf("error %s whilst saving checkpoint", err)
+	}
+}
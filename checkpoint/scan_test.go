@@ -0,0 +1,88 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// inTempDir runs the test in a temporary directory, as the checkpoints are written to the working directory
+func inTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynamotools-checkpoint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+}
+
+func TestTrackerResume(t *testing.T) {
+	inTempDir(t)
+	s := NewScan("update", "jobs", "update SET a = :a", 2)
+	tr := NewTracker(s)
+	key := map[string]*dynamodb.AttributeValue{"id": {S: aws.String("k")}}
+	for segment := 0; segment < 2; segment++ {
+		if start, done := tr.Start(segment); start != nil || done {
+			t.Fatalf("segment %d of a new run starts at %v done %v", segment, start, done)
+		}
+	}
+	tr.Advance(0, 3, nil)
+	tr.Advance(1, 2, key)
+	tr.Flush()
+
+	loaded, err := LoadScan("update", s.RunID, "jobs", "update SET a = :a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Handled != 5 {
+		t.Errorf("handled %d, want 5", loaded.Handled)
+	}
+	resumed := NewTracker(loaded)
+	if _, done := resumed.Start(0); !done {
+		t.Errorf("segment 0 is not done")
+	}
+	if start, done := resumed.Start(1); done || aws.StringValue(start["id"].S) != "k" {
+		t.Errorf("segment 1 starts at %v done %v, want k", start, done)
+	}
+
+	resumed.Remove()
+	if _, err := os.Stat(File("update", s.RunID)); !os.IsNotExist(err) {
+		t.Errorf("the checkpoint was not removed")
+	}
+}
+
+func TestLoadScanMismatch(t *testing.T) {
+	inTempDir(t)
+	s := NewScan("update", "jobs", "update SET a = :a", 2)
+	NewTracker(s).Flush()
+	tests := []struct {
+		name      string
+		table     string
+		operation string
+		segments  int
+	}{
+		{"table", "ads", "update SET a = :a", 2},
+		{"operation", "jobs", "update SET a = :b", 2},
+		{"segments", "jobs", "update SET a = :a", 4},
+	}
+	for _, tt := range tests {
+		if _, err := LoadScan("update", s.RunID, tt.table, tt.operation, tt.segments); err == nil {
+			t.Errorf("%s: resumed a run with a different %s", tt.name, tt.name)
+		}
+	}
+	if _, err := LoadScan("delete", s.RunID, "jobs", "update SET a = :a", 2); err == nil {
+		t.Errorf("resumed the run of another command")
+	}
+}
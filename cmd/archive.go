@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/SEEK-Jobs/dynamotools/archive"
 	"github.com/urfave/cli"
 )
@@ -22,7 +24,15 @@ func BuildArchive() cli.Command {
 			},
 			cli.StringFlag{
 				Name:  "table, t",
-				Usage: "dynamodb table name",
+				Usage: "dynamodb table name, or comma separated names and glob patterns to archive several tables as a group",
+			},
+			cli.StringFlag{
+				Name:  "tag",
+				Usage: "archive the tables with the tag, as key=value or just key, as a group (optional)",
+			},
+			cli.IntFlag{
+				Name:  "table-concurrency",
+				Usage: "number of tables of a group archived at once, 0 for all of them",
 			},
 			cli.StringFlag{
 				Name:  "tableindex, i",
@@ -68,6 +78,79 @@ func BuildArchive() cli.Command {
 				Value: 10,
 				Usage: "concurrency for uploads to the bucket",
 			},
+			cli.StringFlag{
+				Name:  "transform, tf",
+				Usage: "json file with the transforms to apply to every item (optional)",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, only items for which it is truthy are kept (optional)",
+			},
+			cli.StringFlag{
+				Name:  "select",
+				Usage: "jmespath expression returning an object which replaces each item (optional)",
+			},
+			cli.StringFlag{
+				Name:  "format",
+				Value: "json",
+				Usage: "format of the archived data (json|jsonl|csv|parquet)",
+			},
+			cli.StringFlag{
+				Name:  "columns",
+				Usage: "comma separated columns of a csv archive, defaults to the attributes of the first page (optional)",
+			},
+			cli.StringFlag{
+				Name:  "flatten",
+				Value: "json",
+				Usage: "how nested maps are written to csv, as json text or as parent.child columns (json|dot)",
+			},
+			cli.BoolFlag{
+				Name:  "no-header",
+				Usage: "leave the header row out of csv parts",
+			},
+			cli.StringFlag{
+				Name:  "schema",
+				Usage: "json file with the name and type of every parquet column, inferred from --sample items when not given (optional)",
+			},
+			cli.IntFlag{
+				Name:  "sample",
+				Value: 1000,
+				Usage: "number of items the parquet schema is inferred from",
+			},
+			cli.IntFlag{
+				Name:  "row-group",
+				Value: 10000,
+				Usage: "number of items in each parquet row group",
+			},
+			cli.Int64Flag{
+				Name:  "part-size",
+				Usage: "roll the archive over to a new part object after this many MB (optional)",
+			},
+			cli.Int64Flag{
+				Name:  "part-items",
+				Usage: "roll the archive over to a new part object after this many items (optional)",
+			},
+			cli.StringFlag{
+				Name:  "partition-by",
+				Usage: "hive style partitions by an attribute, or a date from it as <attr>:<year|month|day|hour> (optional)",
+			},
+			cli.IntFlag{
+				Name:  "max-open-partitions",
+				Value: 32,
+				Usage: "most partitions with a part open at once, the least recently written is finished first",
+			},
+			cli.BoolFlag{
+				Name:  "per-segment",
+				Usage: "every scan partition writes its own part objects under <table>/segment-0001",
+			},
+			cli.StringFlag{
+				Name:  "retry",
+				Usage: "manifest of a per segment archive, scans its failed segments again and updates it",
+			},
+			cli.StringFlag{
+				Name:  "segments",
+				Usage: "comma separated segments to scan again with --retry instead of the failed ones",
+			},
 			cli.StringFlag{
 				Name:  "prefix, pf",
 				Usage: "folder where archived data will be stored (optional)",
@@ -75,15 +158,15 @@ func BuildArchive() cli.Command {
 		},
 		SkipFlagParsing: false,
 		Before: func(c *cli.Context) error {
-			if c.String("table") == "" && c.String("t") == "" {
-				return cli.NewExitError("missing value for [table]", 86)
+			if c.String("table") == "" && c.String("t") == "" && c.String("tag") == "" {
+				return cli.NewExitError("missing value for [table] or [tag]", 86)
 			} else if c.String("bucket") == "" && c.String("b") == "" {
 				return cli.NewExitError("missing value for [bucket]", 86)
 			}
 			return nil
 		},
 		Action: func(c *cli.Context) error {
-			return archive.ToS3(&archive.S3ArchiveConfig{
+			config := &archive.S3ArchiveConfig{
 				Region:            c.String("region"),
 				TableName:         c.String("table"),
 				TableIndex:        c.String("tableindex"),
@@ -97,8 +180,32 @@ func BuildArchive() cli.Command {
 				UploadChunkSize:   c.Int64("chunksize"),
 				UploadConcurrency: c.Int("concurrency"),
 				BackupPrefix:      c.String("prefix"),
-			})
-
+				TransformFile:     c.String("transform"),
+				Where:             c.String("where"),
+				Select:            c.String("select"),
+				PartSize:          c.Int64("part-size"),
+				PartItems:         c.Int64("part-items"),
+				Format:            c.String("format"),
+				PerSegment:        c.Bool("per-segment"),
+				Retry:             c.String("retry"),
+				RetrySegments:     c.String("segments"),
+				Columns:           c.String("columns"),
+				Flatten:           c.String("flatten"),
+				NoHeader:          c.Bool("no-header"),
+				SchemaFile:        c.String("schema"),
+				Sample:            c.Int("sample"),
+				RowGroupItems:     c.Int("row-group"),
+				PartitionBy:       c.String("partition-by"),
+				MaxOpenPartitions: c.Int("max-open-partitions"),
+			}
+			if c.String("tag") == "" && !strings.ContainsAny(c.String("table"), ",*?[") {
+				return archive.ToS3(config)
+			}
+			tables, err := archive.ResolveTables(c.String("region"), c.String("table"), c.String("tag"))
+			if err != nil {
+				return err
+			}
+			return archive.Group(config, tables, c.Int("table-concurrency"))
 		},
 	}
 }
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/inspect"
+	"github.com/urfave/cli"
+)
+
+// BuildCat builds the cli command for printing the items of an archive
+func BuildCat() cli.Command {
+	return cli.Command{
+		Name:        "cat",
+		Aliases:     []string{"inspect"},
+		Usage:       "source [s3://bucket/key of the archive] where [filter] select [projection] limit [max items] output [json|jsonl|dynamodb|table]",
+		Description: "cat streams the items of the [source] archive to stdout, after the summary of its manifest",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your s3 bucket is",
+			},
+			cli.StringFlag{
+				Name:  "source, s",
+				Usage: "s3://bucket/key of an archive manifest, prefix ending in / or archive file",
+			},
+			cli.StringFlag{
+				Name:  "bucket, b",
+				Usage: "bucket of the source when it is given as just a key (optional)",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, only items for which it is truthy are printed (optional)",
+			},
+			cli.StringFlag{
+				Name:  "select",
+				Usage: "jmespath expression returning an object which is printed instead of each item (optional)",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "stop after printing this many items (optional)",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Value: "json",
+				Usage: "how to print the items (json|jsonl|dynamodb|table)",
+			},
+			cli.BoolFlag{
+				Name:  "summary",
+				Usage: "only print the summary of the manifest",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("source") == "" {
+				return cli.NewExitError("missing value for [source]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return inspect.Cat(&inspect.CatConfig{
+				Region:      c.String("region"),
+				Bucket:      c.String("bucket"),
+				Source:      c.String("source"),
+				Where:       c.String("where"),
+				Select:      c.String("select"),
+				Limit:       c.Int("limit"),
+				Output:      c.String("output"),
+				SummaryOnly: c.Bool("summary"),
+			})
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/copier"
+	"github.com/urfave/cli"
+)
+
+// BuildCopy builds the cli command for copying a table into another table
+func BuildCopy() cli.Command {
+	return cli.Command{
+		Name:        "copy",
+		Usage:       "source-table [dynamo table name] dest-table [dynamo table name]",
+		Description: "copy scans the [source-table] and writes its items straight into the [dest-table], without going through s3",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "source-table",
+				Usage: "dynamodb table to copy from",
+			},
+			cli.StringFlag{
+				Name:  "dest-table",
+				Usage: "dynamodb table to copy to",
+			},
+			cli.StringFlag{
+				Name:  "source-region",
+				Value: "ap-southeast-2",
+				Usage: "aws region name of the source table",
+			},
+			cli.StringFlag{
+				Name:  "dest-region",
+				Usage: "aws region name of the destination table, defaults to the source region (optional)",
+			},
+			cli.StringFlag{
+				Name:  "source-profile",
+				Usage: "aws credentials profile for the source table, defaults to the usual credential chain (optional)",
+			},
+			cli.StringFlag{
+				Name:  "dest-profile",
+				Usage: "aws credentials profile for the destination table, defaults to the usual credential chain (optional)",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "workers, w",
+				Value: 1,
+				Usage: "number of parallel workers putting data in the destination table",
+			},
+			cli.Float64Flag{
+				Name:  "read-capacity",
+				Usage: "read capacity units per second shared by the scan partitions, 0 for no limit (optional)",
+			},
+			cli.Float64Flag{
+				Name:  "write-capacity",
+				Usage: "write capacity units per second shared by the workers, 0 for no limit (optional)",
+			},
+			cli.StringFlag{
+				Name:  "transform, tf",
+				Usage: "json file with the transforms to apply to every item (optional)",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, only items for which it is truthy are copied (optional)",
+			},
+			cli.StringFlag{
+				Name:  "select",
+				Usage: "jmespath expression returning an object which replaces each item (optional)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("source-table") == "" {
+				return cli.NewExitError("missing value for [source-table]", 86)
+			} else if c.String("dest-table") == "" {
+				return cli.NewExitError("missing value for [dest-table]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return copier.Tables(&copier.CopyConfig{
+				SourceRegion:   c.String("source-region"),
+				SourceProfile:  c.String("source-profile"),
+				SourceTable:    c.String("source-table"),
+				DestRegion:     c.String("dest-region"),
+				DestProfile:    c.String("dest-profile"),
+				DestTable:      c.String("dest-table"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Workers:        c.Int("workers"),
+				ReadCapacity:   c.Float64("read-capacity"),
+				WriteCapacity:  c.Float64("write-capacity"),
+				TransformFile:  c.String("transform"),
+				Where:          c.String("where"),
+				Select:         c.String("select"),
+			})
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/deleter"
+	"github.com/urfave/cli"
+)
+
+// BuildDelete builds the cli command for deleting the matching items of a table
+func BuildDelete() cli.Command {
+	return cli.Command{
+		Name:        "delete",
+		Usage:       "table [dynamo table name] where [filter] | keys-file [file]",
+		Description: "delete removes the items of the [table] matching [where] or listed in [keys-file], after asking to confirm how many",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table is",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table name",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, the items for which it is truthy are deleted",
+			},
+			cli.StringFlag{
+				Name:  "keys-file",
+				Usage: "csv file with a header row or json lines file of the primary keys to delete, instead of --where",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "workers, w",
+				Value: 4,
+				Usage: "number of parallel batch deleters",
+			},
+			cli.Float64Flag{
+				Name:  "read-capacity",
+				Usage: "read capacity units per second shared by the scan partitions, 0 for no limit (optional)",
+			},
+			cli.Float64Flag{
+				Name:  "write-capacity",
+				Usage: "write capacity units per second shared by the deleters, 0 for no limit (optional)",
+			},
+			cli.StringFlag{
+				Name:  "archive-bucket",
+				Usage: "s3 bucket to archive the items to before deleting them, nothing is deleted unless the archive completes (optional)",
+			},
+			cli.StringFlag{
+				Name:  "archive-prefix",
+				Usage: "prefix of the archive in the archive bucket (optional)",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "count the items which would be deleted, without deleting them",
+			},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "delete without asking to confirm",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("table") == "" {
+				return cli.NewExitError("missing value for [table]", 86)
+			} else if c.String("where") == "" && c.String("keys-file") == "" {
+				return cli.NewExitError("missing value for [where] or [keys-file]", 86)
+			} else if c.String("where") != "" && c.String("keys-file") != "" {
+				return cli.NewExitError("only one of [where] and [keys-file] can be given", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return deleter.Items(&deleter.DeleteConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Where:          c.String("where"),
+				KeysFile:       c.String("keys-file"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Workers:        c.Int("workers"),
+				ReadCapacity:   c.Float64("read-capacity"),
+				WriteCapacity:  c.Float64("write-capacity"),
+				ArchiveBucket:  c.String("archive-bucket"),
+				ArchivePrefix:  c.String("archive-prefix"),
+				DryRun:         c.Bool("dry-run"),
+				Yes:            c.Bool("yes"),
+			})
+		},
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/diff"
+	"github.com/urfave/cli"
+)
+
+// BuildDiff builds the cli command for comparing two archives
+func BuildDiff() cli.Command {
+	return cli.Command{
+		Name:        "diff",
+		Usage:       "bucket [s3 bucket name] keys [key attributes] <archiveA> <archiveB>",
+		ArgsUsage:   "<archiveA> <archiveB>",
+		Description: "diff matches the items of two archives by primary key and writes the added, removed and modified items as json lines",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your s3 bucket is",
+			},
+			cli.StringFlag{
+				Name:  "bucket, b",
+				Usage: "name of the bucket the archives are in",
+			},
+			cli.StringFlag{
+				Name:  "keys, k",
+				Usage: "comma separated primary key attributes, hash key first",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table to read the primary key attributes from instead of --keys",
+			},
+			cli.StringFlag{
+				Name:  "out, o",
+				Usage: "file to write the json lines to instead of stdout (optional)",
+			},
+			cli.IntFlag{
+				Name:  "sort-items",
+				Value: 100000,
+				Usage: "number of items sorted in memory before they are spilled to disk",
+			},
+			cli.StringFlag{
+				Name:  "tmp",
+				Usage: "directory for the sorted runs, defaults to the system temp directory (optional)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("bucket") == "" {
+				return cli.NewExitError("missing value for [bucket]", 86)
+			} else if c.String("keys") == "" && c.String("table") == "" {
+				return cli.NewExitError("missing value for [keys] or [table]", 86)
+			} else if c.NArg() != 2 {
+				return cli.NewExitError("diff needs two archives, <archiveA> <archiveB>", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return diff.Archives(&diff.DiffConfig{
+				Region:    c.String("region"),
+				Bucket:    c.String("bucket"),
+				From:      c.Args().Get(0),
+				To:        c.Args().Get(1),
+				Keys:      c.String("keys"),
+				TableName: c.String("table"),
+				OutFile:   c.String("out"),
+				SortItems: c.Int("sort-items"),
+				TempDir:   c.String("tmp"),
+			})
+		},
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/SEEK-Jobs/dynamotools/manifest"
 	"github.com/SEEK-Jobs/dynamotools/restore"
 	"github.com/urfave/cli"
 )
@@ -19,13 +20,84 @@ func BuildRestore() cli.Command {
 			},
 			cli.StringFlag{
 				Name:  "table, t",
-				Usage: "dynamodb table name",
+				Usage: "dynamodb table name, with a group manifest only this table of the group is restored",
 			},
 			cli.IntFlag{
 				Name:  "workers, w",
 				Value: 1,
 				Usage: "number of parallel workers putting data in dynamodb table",
 			},
+			cli.StringFlag{
+				Name:  "on-conflict, oc",
+				Value: "overwrite",
+				Usage: "what to do with items which already exist in the table (skip|overwrite|newer-wins:<attr>)",
+			},
+			cli.IntFlag{
+				Name:  "put-concurrency, pc",
+				Value: 10,
+				Usage: "number of parallel conditional puts for the skip and newer-wins conflict modes",
+			},
+			cli.StringFlag{
+				Name:  "transform, tf",
+				Usage: "json file with the transforms to apply to every item (optional)",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, only items for which it is truthy are kept (optional)",
+			},
+			cli.StringFlag{
+				Name:  "select",
+				Usage: "jmespath expression returning an object which replaces each item (optional)",
+			},
+			cli.StringFlag{
+				Name:  "manifest, m",
+				Usage: "archive manifest in the bucket, every part it lists is restored in parallel, or the .group.json of a group archive to restore each of its tables",
+			},
+			cli.StringFlag{
+				Name:  "parts",
+				Usage: "prefix in the bucket, every archive file under it is restored in parallel",
+			},
+			cli.StringFlag{
+				Name:  "export",
+				Usage: "manifest-summary.json, or the prefix it is in, of an AWS managed export to s3 in DYNAMODB_JSON or ION format",
+			},
+			cli.StringFlag{
+				Name:  "columns",
+				Usage: "comma separated name:TYPE columns of csv files, TYPE is S, N, BOOL, SS, NS, M or L and defaults to S (optional)",
+			},
+			cli.BoolFlag{
+				Name:  "no-header",
+				Usage: "csv files have no header row, the --columns give the order of the cells",
+			},
+			cli.IntFlag{
+				Name:  "readers",
+				Value: 4,
+				Usage: "number of archive files read and decoded in parallel",
+			},
+			cli.StringFlag{
+				Name:  "as-of",
+				Usage: "restore the table as it was at this RFC3339 timestamp, picking the archives from the --prefix",
+			},
+			cli.StringFlag{
+				Name:  "prefix, pf",
+				Usage: "folder where the archived data is stored, used with --as-of (optional)",
+			},
+			cli.StringFlag{
+				Name:  "resume",
+				Usage: "run id of a failed restore to continue from its last checkpoint",
+			},
+			cli.StringFlag{
+				Name:  "keys, k",
+				Usage: "csv or json lines file with the primary keys of the items to restore (optional)",
+			},
+			cli.BoolFlag{
+				Name:  "compare",
+				Usage: "report which of the --keys are missing or different in the table instead of restoring them",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "decode and validate every item against the table without writing anything",
+			},
 			cli.StringFlag{
 				Name:  "bucket, b",
 				Usage: "name of the bucket to store the archived data",
@@ -38,22 +110,40 @@ func BuildRestore() cli.Command {
 		},
 		SkipFlagParsing: false,
 		Before: func(c *cli.Context) error {
-			if c.String("table") == "" && c.String("t") == "" {
+			if c.String("table") == "" && c.String("t") == "" && !manifest.IsGroup(c.String("manifest")) {
 				return cli.NewExitError("missing value for [table]", 86)
 			} else if c.String("bucket") == "" && c.String("b") == "" {
 				return cli.NewExitError("missing value for [bucket]", 86)
-			} else if c.String("file") == "" && c.String("f") == "" {
-				return cli.NewExitError("missing value for [file]", 86)
+			} else if c.String("file") == "" && c.String("manifest") == "" && c.String("parts") == "" &&
+				c.String("export") == "" && c.String("as-of") == "" && c.String("resume") == "" {
+				return cli.NewExitError("missing value for [file], [manifest], [parts], [export], [as-of] or [resume]", 86)
 			}
 			return nil
 		},
 		Action: func(c *cli.Context) error {
 			return restore.ToDyanmo(&restore.DynamoResotreConfig{
-				Region:      c.String("region"),
-				TableName:   c.String("table"),
-				Workers:     c.Int("workers"),
-				Bucket:      c.String("bucket"),
-				RestoreFile: c.String("file"),
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Workers:        c.Int("workers"),
+				Bucket:         c.String("bucket"),
+				RestoreFile:    c.String("file"),
+				OnConflict:     c.String("on-conflict"),
+				PutConcurrency: c.Int("put-concurrency"),
+				TransformFile:  c.String("transform"),
+				Where:          c.String("where"),
+				Select:         c.String("select"),
+				KeysFile:       c.String("keys"),
+				CompareKeys:    c.Bool("compare"),
+				AsOf:           c.String("as-of"),
+				Prefix:         c.String("prefix"),
+				Resume:         c.String("resume"),
+				DryRun:         c.Bool("dry-run"),
+				Manifest:       c.String("manifest"),
+				PartsPrefix:    c.String("parts"),
+				Readers:        c.Int("readers"),
+				Export:         c.String("export"),
+				Columns:        c.String("columns"),
+				NoHeader:       c.Bool("no-header"),
 			})
 
 		},
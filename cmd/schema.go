@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/schema"
+	"github.com/urfave/cli"
+)
+
+// BuildSchema builds the cli command for working with the schema of archives
+func BuildSchema() cli.Command {
+	return cli.Command{
+		Name:  "schema",
+		Usage: "infer the schema of an archive or a table",
+		Subcommands: []cli.Command{
+			buildSchemaInfer(),
+		},
+	}
+}
+
+func buildSchemaInfer() cli.Command {
+	return cli.Command{
+		Name:        "infer",
+		Usage:       "source [s3://bucket/key of the archive] or table [dynamo table name] json-schema [file] ddl [file]",
+		Description: "infer reads the [source] archive, or samples the [table], and writes its schema as json schema and as an athena CREATE EXTERNAL TABLE statement",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table or s3 bucket is",
+			},
+			cli.StringFlag{
+				Name:  "source, s",
+				Usage: "s3://bucket/key of an archive manifest, prefix ending in / or archive file",
+			},
+			cli.StringFlag{
+				Name:  "bucket, b",
+				Usage: "bucket of the source when it is given as just a key (optional)",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table to sample instead of an archive",
+			},
+			cli.IntFlag{
+				Name:  "sample",
+				Value: 1000,
+				Usage: "number of items the schema is inferred from, 0 reads the whole archive",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.StringFlag{
+				Name:  "json-schema",
+				Usage: "file to write the json schema to, - for stdout (default when --ddl is not given)",
+			},
+			cli.StringFlag{
+				Name:  "ddl",
+				Usage: "file to write the athena table definition to, - for stdout (optional)",
+			},
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "name of the athena table, defaults to the dynamodb table name (optional)",
+			},
+			cli.StringFlag{
+				Name:  "format, f",
+				Usage: "format of the archive (jsonl|csv|parquet), defaults to the format in the manifest or jsonl (optional)",
+			},
+			cli.StringFlag{
+				Name:  "location",
+				Usage: "s3:// folder the archive parts are in, defaults to the folder of the manifest's parts (optional)",
+			},
+			cli.StringFlag{
+				Name:  "partition-by",
+				Usage: "attribute[:year|month|day|hour] the archive is partitioned by, defaults to the manifest's (optional)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("source") == "" && c.String("table") == "" {
+				return cli.NewExitError("missing value for [source] or [table]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return schema.Infer(&schema.InferConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Bucket:         c.String("bucket"),
+				Source:         c.String("source"),
+				Sample:         c.Int("sample"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Name:           c.String("name"),
+				Format:         c.String("format"),
+				Location:       c.String("location"),
+				PartitionBy:    c.String("partition-by"),
+				JSONSchemaFile: c.String("json-schema"),
+				DDLFile:        c.String("ddl"),
+			})
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/inspect"
+	"github.com/urfave/cli"
+)
+
+// BuildStats builds the cli command for profiling the items of a table or an archive
+func BuildStats() cli.Command {
+	return cli.Command{
+		Name:        "stats",
+		Usage:       "table [dynamo table name] or source [s3://bucket/key of the archive] output [text|json]",
+		Description: "stats scans the [table], or reads the [source] archive, and reports the item count, sizes, attributes and hot partition keys",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table or s3 bucket is",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table to scan, or to read the key attributes of when profiling an archive",
+			},
+			cli.StringFlag{
+				Name:  "source, s",
+				Usage: "s3://bucket/key of an archive manifest, prefix ending in / or archive file to profile instead of the table",
+			},
+			cli.StringFlag{
+				Name:  "bucket, b",
+				Usage: "bucket of the source when it is given as just a key (optional)",
+			},
+			cli.StringFlag{
+				Name:  "keys, k",
+				Usage: "comma separated primary key attributes, hash key first, instead of reading them from the table (optional)",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "readers",
+				Value: 4,
+				Usage: "number of archive files read and decoded in parallel",
+			},
+			cli.IntFlag{
+				Name:  "top",
+				Value: 10,
+				Usage: "number of largest items and hot partition keys to report",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Value: "text",
+				Usage: "how to print the stats (text|json)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("table") == "" && c.String("source") == "" {
+				return cli.NewExitError("missing value for [table] or [source]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return inspect.Profile(&inspect.StatsConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Bucket:         c.String("bucket"),
+				Source:         c.String("source"),
+				Keys:           c.String("keys"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Readers:        c.Int("readers"),
+				Top:            c.Int("top"),
+				Output:         c.String("output"),
+			})
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/deleter"
+	"github.com/urfave/cli"
+)
+
+// BuildTruncate builds the cli command for deleting every item of a table
+func BuildTruncate() cli.Command {
+	return cli.Command{
+		Name:        "truncate",
+		Usage:       "table [dynamo table name]",
+		Description: "truncate deletes every item of the [table], keeping the table with its indexes, stream, alarms, tags and autoscaling",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table is",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table name",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 4,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 1000,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "workers, w",
+				Value: 8,
+				Usage: "number of parallel batch deleters",
+			},
+			cli.Float64Flag{
+				Name:  "read-capacity",
+				Usage: "read capacity units per second shared by the scan partitions, 0 for no limit (optional)",
+			},
+			cli.Float64Flag{
+				Name:  "write-capacity",
+				Value: 100,
+				Usage: "write capacity units per second shared by the deleters, 0 for no limit",
+			},
+			cli.BoolFlag{
+				Name:  "full-speed",
+				Usage: "ignore the capacity limits, for on-demand tables which can take everything the deleters send",
+			},
+			cli.StringFlag{
+				Name:   "protected",
+				Value:  "*prod*",
+				Usage:  "comma separated table name patterns which are never truncated",
+				EnvVar: "DYNAMOTOOLS_PROTECTED_TABLES",
+			},
+			cli.BoolFlag{
+				Name:  "yes, y",
+				Usage: "truncate without asking to confirm",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("table") == "" {
+				return cli.NewExitError("missing value for [table]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return deleter.Truncate(&deleter.TruncateConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Workers:        c.Int("workers"),
+				ReadCapacity:   c.Float64("read-capacity"),
+				WriteCapacity:  c.Float64("write-capacity"),
+				FullSpeed:      c.Bool("full-speed"),
+				Protected:      c.String("protected"),
+				Yes:            c.Bool("yes"),
+			})
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/update"
+	"github.com/urfave/cli"
+)
+
+// BuildUpdate builds the cli command for updating the matching items of a table
+func BuildUpdate() cli.Command {
+	return cli.Command{
+		Name:        "update",
+		Usage:       "table [dynamo table name] where [filter] set [update expression]",
+		Description: "update scans or queries the [table] and applies the [set] update expression to every item matching [where]",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table is",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table name",
+			},
+			cli.StringFlag{
+				Name:  "where",
+				Usage: "jmespath expression, only items for which it is truthy are updated (optional)",
+			},
+			cli.StringFlag{
+				Name:  "set",
+				Usage: "dynamodb UpdateExpression applied to every item, e.g. \"SET #s = :status\"",
+			},
+			cli.StringFlag{
+				Name:  "condition",
+				Usage: "dynamodb ConditionExpression every item has to meet to be updated (optional)",
+			},
+			cli.StringFlag{
+				Name:  "values",
+				Usage: "json object of placeholder values, e.g. {\":status\": \"open\"}, other placeholders take the item's attribute of the same name (optional)",
+			},
+			cli.StringFlag{
+				Name:  "key-condition",
+				Usage: "dynamodb KeyConditionExpression to query the table with instead of scanning it (optional)",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "workers, w",
+				Value: 10,
+				Usage: "number of parallel updates",
+			},
+			cli.Float64Flag{
+				Name:  "read-capacity",
+				Usage: "read capacity units per second shared by the scan partitions, 0 for no limit (optional)",
+			},
+			cli.Float64Flag{
+				Name:  "write-capacity",
+				Usage: "write capacity units per second shared by the workers, 0 for no limit (optional)",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the key and placeholder values of every item which would be updated, without updating it",
+			},
+			cli.StringFlag{
+				Name:  "resume",
+				Usage: "run id of an update which did not finish, to continue it from its checkpoint (optional)",
+			},
+			cli.BoolFlag{
+				Name:  "upsert",
+				Usage: "also update items which were deleted since the scan, creating them with just the key and set attributes",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("table") == "" {
+				return cli.NewExitError("missing value for [table]", 86)
+			} else if c.String("set") == "" {
+				return cli.NewExitError("missing value for [set]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			return update.Items(&update.UpdateConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Where:          c.String("where"),
+				Set:            c.String("set"),
+				Condition:      c.String("condition"),
+				Values:         c.String("values"),
+				KeyCondition:   c.String("key-condition"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Workers:        c.Int("workers"),
+				ReadCapacity:   c.Float64("read-capacity"),
+				WriteCapacity:  c.Float64("write-capacity"),
+				DryRun:         c.Bool("dry-run"),
+				Resume:         c.String("resume"),
+				Upsert:         c.Bool("upsert"),
+			})
+		},
+	}
+}
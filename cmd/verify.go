@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"github.com/SEEK-Jobs/dynamotools/verify"
+	"github.com/urfave/cli"
+)
+
+// BuildVerify builds the cli command for verifying an archive against the live table
+func BuildVerify() cli.Command {
+	return cli.Command{
+		Name:        "verify",
+		Usage:       "region [aws region name] table [dynamo table name] bucket [s3 bucket name] source [archive in the bucket]",
+		Description: "verify scans the [table] and reads the [source] archive from the [bucket] at the same time and reports the items which do not match",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "region, r",
+				Value: "ap-southeast-2",
+				Usage: "aws region name where your dynamodb table and s3 bucket is",
+			},
+			cli.StringFlag{
+				Name:  "table, t",
+				Usage: "dynamodb table name",
+			},
+			cli.StringFlag{
+				Name:  "bucket, b",
+				Usage: "name of the bucket the archive is in",
+			},
+			cli.StringFlag{
+				Name:  "source, s",
+				Usage: "archive manifest, prefix ending in / or single archive file in the bucket",
+			},
+			cli.IntFlag{
+				Name:  "partitions, p",
+				Value: 1,
+				Usage: "partitions for parallel scanning",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Value: 100,
+				Usage: "limit for scanning records",
+			},
+			cli.IntFlag{
+				Name:  "readers",
+				Value: 4,
+				Usage: "number of archive files read and decoded in parallel",
+			},
+			cli.StringFlag{
+				Name:  "report",
+				Usage: "file to write the json lines report to instead of stdout (optional)",
+			},
+			cli.IntFlag{
+				Name:  "sort-items",
+				Value: 100000,
+				Usage: "number of keys sorted in memory before they are spilled to disk",
+			},
+			cli.StringFlag{
+				Name:  "tmp",
+				Usage: "directory for the sorted runs, defaults to the system temp directory (optional)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if c.String("table") == "" {
+				return cli.NewExitError("missing value for [table]", 86)
+			} else if c.String("bucket") == "" {
+				return cli.NewExitError("missing value for [bucket]", 86)
+			} else if c.String("source") == "" {
+				return cli.NewExitError("missing value for [source]", 86)
+			}
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			err := verify.Compare(&verify.VerifyConfig{
+				Region:         c.String("region"),
+				TableName:      c.String("table"),
+				Bucket:         c.String("bucket"),
+				Source:         c.String("source"),
+				ScanPartitions: c.Int("partitions"),
+				ScanLimit:      c.Int("limit"),
+				Readers:        c.Int("readers"),
+				ReportFile:     c.String("report"),
+				SortItems:      c.Int("sort-items"),
+				TempDir:        c.String("tmp"),
+			})
+			if err == verify.ErrMismatch {
+				return cli.NewExitError(err.Error(), 2)
+			} else if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			return nil
+		},
+	}
+}
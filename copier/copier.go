@@ -0,0 +1,136 @@
+package copier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/restore"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/SEEK-Jobs/dynamotools/transform"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"golang.org/x/sync/errgroup"
+)
+
+// itemsBuffer is how many scanned items can wait for a writer
+const itemsBuffer = 1000
+
+// CopyConfig provides the configuration for copying a dynamo table into another one
+type CopyConfig struct {
+	SourceRegion   string
+	SourceProfile  string
+	SourceTable    string
+	DestRegion     string
+	DestProfile    string
+	DestTable      string
+	ScanPartitions int
+	ScanLimit      int
+	Workers        int
+	ReadCapacity   float64
+	WriteCapacity  float64
+	TransformFile  string
+	Where          string
+	Select         string
+}
+
+// Tables scans the source table in parallel segments straight into the batch writers of the destination table.
+// The segments share a read capacity limit and the writers a write capacity limit.
+func Tables(c *CopyConfig) error {
+	if c.DestRegion == "" {
+		c.DestRegion = c.SourceRegion
+	}
+	if c.SourceTable == c.DestTable && c.SourceRegion == c.DestRegion && c.SourceProfile == c.DestProfile {
+		return fmt.Errorf("can not copy %s onto itself", c.SourceTable)
+	}
+
+	var t *transform.Transformer
+	var err error
+	if c.TransformFile != "" {
+		if t, err = transform.Load(c.TransformFile); err != nil {
+			return err
+		}
+	}
+	f, err := filter.New(c.Where, c.Select)
+	if err != nil {
+		return err
+	}
+	if c.Workers < 1 {
+		c.Workers = 1
+	}
+
+	srcSession, err := awssession.NewWithProfile(c.SourceRegion, c.SourceProfile)
+	if err != nil {
+		return err
+	}
+	destSession, err := awssession.NewWithProfile(c.DestRegion, c.DestProfile)
+	if err != nil {
+		return err
+	}
+	return copyTable(dynamodb.New(srcSession), dynamodb.New(destSession), c, t, f)
+}
+
+// copyTable copies the items of the source table into the destination table, decoded so that sets stay sets and
+// numbers keep all their digits
+func copyTable(srcDB, destDB dynamodbiface.DynamoDBAPI, c *CopyConfig, t *transform.Transformer, f *filter.Filter) error {
+	srcKeys, err := table.KeySchema(srcDB, c.SourceTable)
+	if err != nil {
+		return err
+	}
+	destKeys, err := table.KeySchema(destDB, c.DestTable)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(srcKeys, destKeys) {
+		log.Printf("warning %s has the key %v and %s the key %v, the transforms have to make up the difference",
+			c.SourceTable, srcKeys, c.DestTable, destKeys)
+	}
+
+	var copied int64
+	done := func() { atomic.AddInt64(&copied, 1) }
+	itemsChan := make(chan *restore.Item, itemsBuffer)
+	writeLimit := ratelimit.New(c.WriteCapacity)
+
+	writers, ctx := errgroup.WithContext(context.Background())
+	for index := 0; index < c.Workers; index++ {
+		writers.Go(func() error {
+			return restore.NewDynamoBatchWriter(destDB, c.DestTable, writeLimit).Write(itemsChan)
+		})
+	}
+
+	log.Printf("copying %s to %s", c.SourceTable, c.DestTable)
+	serr := archive.Scan(srcDB, &archive.ScanConfig{
+		TableName: c.SourceTable,
+		Segments:  c.ScanPartitions,
+		Limit:     c.ScanLimit,
+		Filter:    f,
+		Transform: t,
+		Limiter:   ratelimit.New(c.ReadCapacity),
+		Lossless:  true,
+	}, func(items []map[string]interface{}) error {
+		for _, item := range items {
+			select {
+			case itemsChan <- &restore.Item{Attributes: item, Done: done}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(itemsChan)
+	if err := writers.Wait(); err != nil {
+		log.Printf("error %s whilst writing to %s", err, c.DestTable)
+		return err
+	}
+	if serr != nil {
+		return serr
+	}
+	log.Printf("copied %d items from %s to %s", atomic.LoadInt64(&copied), c.SourceTable, c.DestTable)
+	return nil
+}
@@ -0,0 +1,85 @@
+package copier
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeTable is a table keyed by id, scanned in a single page by segment 0, which keeps what is written to it
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeTable(items ...map[string]*dynamodb.AttributeValue) *fakeTable {
+	ft := &fakeTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	for _, item := range items {
+		ft.items[aws.StringValue(item["id"].S)] = item
+	}
+	return ft
+}
+
+func (ft *fakeTable) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+		TableName: in.TableName,
+		KeySchema: []*dynamodb.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+	}}, nil
+}
+
+func (ft *fakeTable) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	out := &dynamodb.ScanOutput{}
+	if aws.Int64Value(in.Segment) == 0 {
+		for _, item := range ft.items {
+			out.Items = append(out.Items, item)
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func (ft *fakeTable) BatchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, reqs := range in.RequestItems {
+		for _, req := range reqs {
+			ft.items[aws.StringValue(req.PutRequest.Item["id"].S)] = req.PutRequest.Item
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestCopyTableRoundTrip(t *testing.T) {
+	item := map[string]*dynamodb.AttributeValue{
+		"id":    {S: aws.String("a")},
+		"big":   {N: aws.String("12345678901234567")},
+		"small": {N: aws.String("1.5")},
+		"tags":  {SS: aws.StringSlice([]string{"x", "y"})},
+		"ids":   {NS: aws.StringSlice([]string{"1", "98765432109876543"})},
+		"blobs": {BS: [][]byte{[]byte("one"), []byte("two")}},
+		"blob":  {B: []byte("three")},
+		"list":  {L: []*dynamodb.AttributeValue{{S: aws.String("x")}, {N: aws.String("2")}}},
+		"map":   {M: map[string]*dynamodb.AttributeValue{"n": {N: aws.String("11111111111111111111")}}},
+		"flag":  {BOOL: aws.Bool(true)},
+		"none":  {NULL: aws.Bool(true)},
+	}
+	src, dest := newFakeTable(item), newFakeTable()
+	c := &CopyConfig{SourceTable: "jobs", DestTable: "jobs-copy", ScanPartitions: 2, Workers: 2}
+	if err := copyTable(src, dest, c, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := dest.items["a"]
+	for name, want := range item {
+		if !reflect.DeepEqual(got[name], want) {
+			t.Errorf("%s: copied %v, want %v", name, got[name], want)
+		}
+	}
+	if len(got) != len(item) {
+		t.Errorf("copied %d attributes, want %d", len(got), len(item))
+	}
+}
@@ -0,0 +1,326 @@
+package deleter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/restore"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"golang.org/x/sync/errgroup"
+)
+
+// keysBuffer is how many keys can wait for a deleter
+const keysBuffer = 1000
+
+// DeleteConfig provides the configuration for deleting the matching items of a table
+type DeleteConfig struct {
+	Region         string
+	TableName      string
+	Where          string
+	KeysFile       string
+	ScanPartitions int
+	ScanLimit      int
+	Workers        int
+	ReadCapacity   float64
+	WriteCapacity  float64
+	ArchiveBucket  string
+	ArchivePrefix  string
+	DryRun         bool
+	Yes            bool
+}
+
+// Items deletes the items matching the where filter, or the items with the keys of the keys file. The keys are
+// collected first, archiving the items when an archive bucket is given, and only deleted once the archive is
+// complete and the count has been confirmed.
+func Items(c *DeleteConfig) error {
+	if (c.Where == "") == (c.KeysFile == "") {
+		return fmt.Errorf("delete takes either a where filter or a keys file")
+	}
+	s := awssession.New(c.Region)
+	var ar *archive.ItemArchive
+	if c.ArchiveBucket != "" && !c.DryRun {
+		var err error
+		if ar, err = archive.NewItemArchive(s, c.ArchiveBucket, c.ArchivePrefix, c.TableName); err != nil {
+			return err
+		}
+	}
+	return deleteItems(dynamodb.New(s), c, ar, os.Stdin, os.Stderr)
+}
+
+// deleteItems collects the keys to delete, archiving their items with ar when it is not nil, and deletes them once
+// the table name has been typed back to in
+func deleteItems(db dynamodbiface.DynamoDBAPI, c *DeleteConfig, ar *archive.ItemArchive, in io.Reader, out io.Writer) error {
+	keyAttrs, err := table.KeySchema(db, c.TableName)
+	if err != nil {
+		return err
+	}
+	var keys []map[string]interface{}
+	if c.KeysFile != "" {
+		keys, err = keysFromFile(db, c, keyAttrs, ar)
+	} else {
+		keys, err = keysFromScan(db, c, keyAttrs, ar)
+	}
+	if ar != nil {
+		key, aerr := ar.Close(err)
+		if aerr != nil {
+			log.Printf("error %s whilst archiving the items to delete, nothing was deleted", aerr)
+			return aerr
+		}
+		log.Printf("archived the %d items to delete in %s", len(keys), key)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.DryRun {
+		log.Printf("would delete %d items from %s", len(keys), c.TableName)
+		return nil
+	}
+	if len(keys) == 0 {
+		log.Printf("no items to delete from %s", c.TableName)
+		return nil
+	}
+	if !c.Yes && !confirm(in, out, fmt.Sprintf("delete %d items from %s?", len(keys), c.TableName), c.TableName) {
+		return fmt.Errorf("deleting from %s was not confirmed, nothing was deleted", c.TableName)
+	}
+	return deleteKeys(db, c, keyAttrs, keys)
+}
+
+// keysFromScan scans the table for the items matching the where filter and returns their keys, taken from the
+// attribute values dynamo returned so that no digits of number keys are lost
+func keysFromScan(db dynamodbiface.DynamoDBAPI, c *DeleteConfig, keyAttrs []string, ar *archive.ItemArchive) ([]map[string]interface{}, error) {
+	f, err := filter.New(c.Where, "")
+	if err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var keys []map[string]interface{}
+	err = archive.ScanAttributes(db, &archive.ScanConfig{
+		TableName: c.TableName,
+		Segments:  c.ScanPartitions,
+		Limit:     c.ScanLimit,
+		Filter:    f,
+		Limiter:   ratelimit.New(c.ReadCapacity),
+	}, func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error {
+		if err := archiveItems(ar, attrs); err != nil {
+			return err
+		}
+		pageKeys, err := keysOf(attrs, keyAttrs)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, pageKeys...)
+		return nil
+	})
+	return keys, err
+}
+
+// keysOf returns the keys of the items from their key attribute values, numbers a float64 can not hold exactly
+// are kept as a dynamodbattribute.Number
+func keysOf(attrs []map[string]*dynamodb.AttributeValue, keyAttrs []string) ([]map[string]interface{}, error) {
+	keys := make([]map[string]interface{}, 0, len(attrs))
+	for _, av := range attrs {
+		key, err := source.ItemFromAttributes(table.KeyAttributes(av, keyAttrs))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// archiveItems writes the items to the archive, decoded like the items of any other archive
+func archiveItems(ar *archive.ItemArchive, attrs []map[string]*dynamodb.AttributeValue) error {
+	if ar == nil || len(attrs) == 0 {
+		return nil
+	}
+	var items []map[string]interface{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(attrs, &items); err != nil {
+		return err
+	}
+	return ar.Write(items)
+}
+
+// keysFromFile reads the keys file, typing the csv values like the key attributes of the table, number keys as a
+// dynamodbattribute.Number so they keep all their digits. With an archive the items are read first and the keys
+// which are not in the table are left out.
+func keysFromFile(db dynamodbiface.DynamoDBAPI, c *DeleteConfig, keyAttrs []string, ar *archive.ItemArchive) ([]map[string]interface{}, error) {
+	keys, err := restore.LoadKeys(c.KeysFile, keyAttrs)
+	if err != nil {
+		return nil, err
+	}
+	types, err := table.KeyTypes(db, c.TableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		for a, v := range key {
+			s, ok := v.(string)
+			if !ok || types[a] != dynamodb.ScalarAttributeTypeN {
+				continue
+			}
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("key %v has %s %q, which is not a number", key, a, s)
+			}
+			key[a] = dynamodbattribute.Number(s)
+		}
+	}
+	if ar == nil {
+		return keys, nil
+	}
+
+	var found []map[string]interface{}
+	limiter := ratelimit.New(c.ReadCapacity)
+	const batchSize = 100 // BatchGetItem limit
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		attrs, err := getItems(db, c.TableName, keys[start:end], limiter)
+		if err != nil {
+			log.Printf("error %s whilst reading the items to delete from %s", err, c.TableName)
+			return nil, err
+		}
+		if err := archiveItems(ar, attrs); err != nil {
+			return nil, err
+		}
+		foundKeys, err := keysOf(attrs, keyAttrs)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, foundKeys...)
+	}
+	if missing := len(keys) - len(found); missing != 0 {
+		log.Printf("%d of the keys are not in %s", missing, c.TableName)
+	}
+	return found, nil
+}
+
+// getItems reads the attribute values of the items with the keys, retrying unprocessed keys
+func getItems(db dynamodbiface.DynamoDBAPI, tableName string, keys []map[string]interface{}, limiter *ratelimit.Limiter) ([]map[string]*dynamodb.AttributeValue, error) {
+	var avKeys []map[string]*dynamodb.AttributeValue
+	for _, key := range keys {
+		av, err := dynamodbattribute.MarshalMap(key)
+		if err != nil {
+			return nil, err
+		}
+		avKeys = append(avKeys, av)
+	}
+
+	var items []map[string]*dynamodb.AttributeValue
+	delay := 250 * time.Millisecond
+	for len(avKeys) != 0 {
+		resp, err := db.BatchGetItem(&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				tableName: {Keys: avKeys, ConsistentRead: aws.Bool(true)},
+			},
+			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, cc := range resp.ConsumedCapacity {
+			limiter.Wait(aws.Float64Value(cc.CapacityUnits))
+		}
+		items = append(items, resp.Responses[tableName]...)
+
+		avKeys = nil
+		if unprocessed, ok := resp.UnprocessedKeys[tableName]; ok && len(unprocessed.Keys) != 0 {
+			log.Printf("retrying unprocessed keys after %v", delay)
+			time.Sleep(delay)
+			delay *= 2
+			avKeys = unprocessed.Keys
+		}
+	}
+	return items, nil
+}
+
+// confirm asks the question and waits for the table name to be typed back before anything is deleted
+func confirm(in io.Reader, out io.Writer, question, tableName string) bool {
+	fmt.Fprintf(out, "%s type the table name to confirm: ", question)
+	line, _ := bufio.NewReader(in).ReadString('\n')
+	return strings.TrimSpace(line) == tableName
+}
+
+// deleteKeys sends the keys to the batch deleters
+func deleteKeys(db dynamodbiface.DynamoDBAPI, c *DeleteConfig, keyAttrs []string, keys []map[string]interface{}) error {
+	d := newDeleters(db, c.TableName, keyAttrs, c.Workers, ratelimit.New(c.WriteCapacity))
+	log.Printf("deleting %d items from %s", len(keys), c.TableName)
+	serr := d.send(keys)
+	if err := d.wait(); err != nil {
+		log.Printf("error %s whilst deleting from %s, %d items were deleted", err, c.TableName, d.count())
+		return err
+	}
+	if serr != nil {
+		return serr
+	}
+	log.Printf("deleted %d items from %s", d.count(), c.TableName)
+	return nil
+}
+
+// deleters are the batch deleters of a table, which share the write capacity limit
+type deleters struct {
+	deleted int64
+	keys    chan *restore.Item
+	grp     *errgroup.Group
+	ctx     context.Context
+}
+
+func newDeleters(db dynamodbiface.DynamoDBAPI, tableName string, keyAttrs []string, workers int, limiter *ratelimit.Limiter) *deleters {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &deleters{keys: make(chan *restore.Item, keysBuffer)}
+	d.grp, d.ctx = errgroup.WithContext(context.Background())
+	for index := 0; index < workers; index++ {
+		d.grp.Go(func() error {
+			return restore.NewDynamoBatchDeleter(db, tableName, keyAttrs, limiter).Write(d.keys)
+		})
+	}
+	return d
+}
+
+// send queues the items for deleting by their keys, it stops early once a deleter has failed
+func (d *deleters) send(items []map[string]interface{}) error {
+	done := func() { atomic.AddInt64(&d.deleted, 1) }
+	for _, item := range items {
+		select {
+		case d.keys <- &restore.Item{Attributes: item, Done: done}:
+		case <-d.ctx.Done():
+			return d.ctx.Err()
+		}
+	}
+	return nil
+}
+
+// wait waits for the queued keys to be deleted, returning the error of the first deleter which failed
+func (d *deleters) wait() error {
+	close(d.keys)
+	return d.grp.Wait()
+}
+
+// count returns how many items have been deleted so far
+func (d *deleters) count() int64 {
+	return atomic.LoadInt64(&d.deleted)
+}
@@ -0,0 +1,222 @@
+package deleter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeTable is a table with a number hash key id, scanned in a single page by segment 0
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func newFakeTable(items ...map[string]*dynamodb.AttributeValue) *fakeTable {
+	ft := &fakeTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	for _, item := range items {
+		ft.items[aws.StringValue(item["id"].N)] = item
+	}
+	return ft
+}
+
+// ids returns the ids left in the table in order
+func (ft *fakeTable) ids() []string {
+	var ids []string
+	for id := range ft.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (ft *fakeTable) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+		TableName:            in.TableName,
+		ItemCount:            aws.Int64(int64(len(ft.items))),
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)}},
+	}}, nil
+}
+
+func (ft *fakeTable) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	out := &dynamodb.ScanOutput{}
+	if aws.Int64Value(in.Segment) == 0 {
+		for _, id := range ft.ids() {
+			out.Items = append(out.Items, ft.items[id])
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func (ft *fakeTable) BatchGetItem(in *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+	for table, ka := range in.RequestItems {
+		for _, key := range ka.Keys {
+			if item, ok := ft.items[aws.StringValue(key["id"].N)]; ok {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (ft *fakeTable) BatchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	for _, reqs := range in.RequestItems {
+		for _, req := range reqs {
+			delete(ft.items, aws.StringValue(req.DeleteRequest.Key["id"].N))
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func item(id, status string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"id": {N: aws.String(id)}, "status": {S: aws.String(status)}}
+}
+
+func writeKeys(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKeysFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"keys.csv", "id\n12345678901234567\n2\n", false},
+		{"keys.jsonl", "{\"id\": 12345678901234567}\n{\"id\": \"2\"}\n", false},
+		{"bad.csv", "id\nx\n", true},
+	}
+	for _, tt := range tests {
+		c := &DeleteConfig{TableName: "jobs", KeysFile: writeKeys(t, dir, tt.name, tt.content)}
+		keys, err := keysFromFile(newFakeTable(), c, []string{"id"}, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		var ids []string
+		for _, key := range keys {
+			av, err := dynamodbattribute.MarshalMap(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, aws.StringValue(av["id"].N))
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, ",") != "12345678901234567,2" {
+			t.Errorf("%s: keys %v, want 12345678901234567 and 2", tt.name, ids)
+		}
+	}
+}
+
+func TestDeleteItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keysFile := writeKeys(t, dir, "keys.csv", "id\n12345678901234567\n3\n")
+
+	tests := []struct {
+		name     string
+		c        DeleteConfig
+		typed    string
+		wantErr  bool
+		wantLeft string
+	}{
+		{"where", DeleteConfig{Where: "status == 'closed'", Yes: true}, "", false, "12345678901234568,2"},
+		{"keys file", DeleteConfig{KeysFile: keysFile, Yes: true}, "", false, "12345678901234568,2"},
+		{"confirmed", DeleteConfig{Where: "status == 'closed'"}, "jobs\n", false, "12345678901234568,2"},
+		{"not confirmed", DeleteConfig{Where: "status == 'closed'"}, "job\n", true, "12345678901234567,12345678901234568,2,3"},
+		{"dry run", DeleteConfig{Where: "status == 'closed'", DryRun: true}, "", false, "12345678901234567,12345678901234568,2,3"},
+		{"nothing matches", DeleteConfig{Where: "status == 'draft'"}, "", false, "12345678901234567,12345678901234568,2,3"},
+	}
+	for _, tt := range tests {
+		// the first two ids are the same as a float64, only the first is closed.
+		db := newFakeTable(item("12345678901234567", "closed"), item("12345678901234568", "open"), item("2", "open"), item("3", "closed"))
+		c := tt.c
+		c.TableName = "jobs"
+		var out bytes.Buffer
+		err := deleteItems(db, &c, nil, strings.NewReader(tt.typed), &out)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if left := strings.Join(db.ids(), ","); left != tt.wantLeft {
+			t.Errorf("%s: left %s, want %s", tt.name, left, tt.wantLeft)
+		}
+		if asked := out.Len() != 0; asked == (c.Yes || c.DryRun || tt.name == "nothing matches") {
+			t.Errorf("%s: asked %q", tt.name, out.String())
+		}
+	}
+}
+
+func TestProtected(t *testing.T) {
+	tests := []struct {
+		table    string
+		patterns string
+		want     string
+	}{
+		{"jobs-prod", "*-prod,*-production", "*-prod"},
+		{"Jobs-PROD", " *-prod ", "*-prod"},
+		{"jobs-staging", "*-prod,*-production", ""},
+		{"jobs", "", ""},
+		{"jobs", ",,", ""},
+	}
+	for _, tt := range tests {
+		got, ok := protected(tt.table, tt.patterns)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s %q: protected by %q %t, want %q", tt.table, tt.patterns, got, ok, tt.want)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		typed string
+		want  bool
+	}{
+		{"jobs\n", true},
+		{"  jobs  \n", true},
+		{"jobs", true},
+		{"JOBS\n", false},
+		{"yes\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if got := confirm(strings.NewReader(tt.typed), &out, "delete?", "jobs"); got != tt.want {
+			t.Errorf("%q: confirmed %t, want %t", tt.typed, got, tt.want)
+		}
+		if !strings.HasPrefix(out.String(), "delete? ") {
+			t.Errorf("%q: asked %q", tt.typed, out.String())
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package deleter
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// progressInterval is how often truncate logs how far it has got
+const progressInterval = 10 * time.Second
+
+// TruncateConfig provides the configuration for deleting every item of a table
+type TruncateConfig struct {
+	Region         string
+	TableName      string
+	ScanPartitions int
+	ScanLimit      int
+	Workers        int
+	ReadCapacity   float64
+	WriteCapacity  float64
+	FullSpeed      bool
+	Protected      string
+	Yes            bool
+}
+
+// Truncate deletes every item of the table while keeping the table itself, so its indexes, stream, alarms, tags
+// and autoscaling stay as they are. Only the key attributes are scanned, and the keys are deleted as the pages
+// arrive. Tables matching one of the protected patterns are refused.
+func Truncate(c *TruncateConfig) error {
+	if pattern, ok := protected(c.TableName, c.Protected); ok {
+		return fmt.Errorf("refusing to truncate %s, it matches the protected table pattern %q", c.TableName, pattern)
+	}
+	if c.FullSpeed {
+		c.ReadCapacity, c.WriteCapacity = 0, 0
+	}
+	return truncate(dynamodb.New(awssession.New(c.Region)), c, os.Stdin, os.Stderr)
+}
+
+// truncate deletes every item of the table once the table name has been typed back to in, by the key attribute
+// values the scan returned
+func truncate(db dynamodbiface.DynamoDBAPI, c *TruncateConfig, in io.Reader, out io.Writer) error {
+	keyAttrs, err := table.KeySchema(db, c.TableName)
+	if err != nil {
+		return err
+	}
+	desc, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(c.TableName)})
+	if err != nil {
+		return err
+	}
+	// the item count is only refreshed every few hours, so it is an estimate.
+	about := aws.Int64Value(desc.Table.ItemCount)
+
+	question := fmt.Sprintf("delete every item of %s, about %d items?", c.TableName, about)
+	if !c.Yes && !confirm(in, out, question, c.TableName) {
+		return fmt.Errorf("truncating %s was not confirmed, nothing was deleted", c.TableName)
+	}
+
+	log.Printf("truncating %s, about %d items", c.TableName, about)
+	started := time.Now()
+	d := newDeleters(db, c.TableName, keyAttrs, c.Workers, ratelimit.New(c.WriteCapacity))
+	stop := make(chan struct{})
+	go reportProgress(d, c.TableName, about, started, stop)
+	serr := archive.ScanAttributes(db, &archive.ScanConfig{
+		TableName:  c.TableName,
+		Segments:   c.ScanPartitions,
+		Limit:      c.ScanLimit,
+		Attributes: keyAttrs,
+		Limiter:    ratelimit.New(c.ReadCapacity),
+	}, func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error {
+		keys, err := keysOf(attrs, keyAttrs)
+		if err != nil {
+			return err
+		}
+		return d.send(keys)
+	})
+	err = d.wait()
+	close(stop)
+	if err == nil {
+		err = serr
+	}
+	if err != nil {
+		log.Printf("error %s whilst truncating %s, %d items were deleted", err, c.TableName, d.count())
+		return err
+	}
+	log.Printf("truncated %s, deleted %d items in %v", c.TableName, d.count(), time.Since(started).Round(time.Second))
+	return nil
+}
+
+// protected returns the comma separated pattern the table name matches, if any
+func protected(tableName, patterns string) (string, bool) {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(tableName)); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// reportProgress logs how many items have been deleted until stop is closed
+func reportProgress(d *deleters, tableName string, about int64, started time.Time, stop chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			deleted := d.count()
+			log.Printf("deleted %d of about %d items from %s, %.0f items/s",
+				deleted, about, tableName, float64(deleted)/time.Since(started).Seconds())
+		case <-stop:
+			return
+		}
+	}
+}
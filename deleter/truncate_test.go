@@ -0,0 +1,41 @@
+package deleter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		yes      bool
+		typed    string
+		wantErr  bool
+		wantLeft string
+	}{
+		{"yes", true, "", false, ""},
+		{"confirmed", false, "jobs-test\n", false, ""},
+		{"not confirmed", false, "jobs\n", true, "12345678901234567,12345678901234568,2"},
+	}
+	for _, tt := range tests {
+		// the first two ids are the same as a float64, so each is only deleted by its own key.
+		db := newFakeTable(item("12345678901234567", "open"), item("12345678901234568", "open"), item("2", "closed"))
+		c := &TruncateConfig{TableName: "jobs-test", ScanPartitions: 2, Workers: 2, Yes: tt.yes}
+		var out bytes.Buffer
+		err := truncate(db, c, strings.NewReader(tt.typed), &out)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+		if left := strings.Join(db.ids(), ","); left != tt.wantLeft {
+			t.Errorf("%s: left %s, want %s", tt.name, left, tt.wantLeft)
+		}
+	}
+}
+
+func TestTruncateProtected(t *testing.T) {
+	c := &TruncateConfig{TableName: "jobs-prod", Protected: "*prod*", Yes: true}
+	if err := Truncate(c); err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Errorf("truncating a protected table returned %v", err)
+	}
+}
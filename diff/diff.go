@@ -0,0 +1,244 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/extsort"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// change types
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// DiffConfig provides the configuration for comparing two archives
+type DiffConfig struct {
+	Region    string
+	Bucket    string
+	From      string
+	To        string
+	Keys      string
+	TableName string
+	OutFile   string
+	SortItems int
+	TempDir   string
+}
+
+// change is a json line of the diff
+type change struct {
+	Type    string                 `json:"type"`
+	Key     map[string]interface{} `json:"key"`
+	Item    json.RawMessage        `json:"item,omitempty"`
+	Changes []attributeChange      `json:"changes,omitempty"`
+}
+
+// attributeChange is a top level attribute of a modified item which was added, removed or changed
+type attributeChange struct {
+	Attribute string          `json:"attribute"`
+	From      json.RawMessage `json:"from,omitempty"`
+	To        json.RawMessage `json:"to,omitempty"`
+}
+
+// Archives writes the items added, removed and modified between the From and To archives as json lines. Both
+// archives are sorted by key on disk so they can be far bigger than memory, then merged.
+func Archives(c *DiffConfig) error {
+	s := awssession.New(c.Region)
+
+	keyAttrs := splitKeys(c.Keys)
+	if len(keyAttrs) == 0 {
+		if c.TableName == "" {
+			return fmt.Errorf("diff needs the key attributes or a table to read them from")
+		}
+		var err error
+		if keyAttrs, err = table.KeySchema(dynamodb.New(s), c.TableName); err != nil {
+			return err
+		}
+	}
+	if c.SortItems < 1 {
+		c.SortItems = 100000
+	}
+
+	dir, err := ioutil.TempDir(c.TempDir, "dynamotools-diff-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	from, to := extsort.NewSorter(dir, c.SortItems), extsort.NewSorter(dir, c.SortItems)
+	var grp errgroup.Group
+	grp.Go(func() error { return readArchive(s, c.Bucket, c.From, keyAttrs, from) })
+	grp.Go(func() error { return readArchive(s, c.Bucket, c.To, keyAttrs, to) })
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if c.OutFile != "" {
+		f, err := os.Create(c.OutFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	a, err := from.Sorted()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := to.Sorted()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	counts, err := merge(json.NewEncoder(w), extsort.NewUnique(a), extsort.NewUnique(b), keyAttrs)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d added, %d removed, %d modified", counts[Added], counts[Removed], counts[Modified])
+	return nil
+}
+
+func splitKeys(keys string) []string {
+	var attrs []string
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			attrs = append(attrs, k)
+		}
+	}
+	return attrs
+}
+
+// readArchive adds every item of the archive to the sorter
+func readArchive(s *session.Session, bucket, src string, keyAttrs []string, st *extsort.Sorter) error {
+	files, err := source.Files(s3.New(s), bucket, src)
+	if err != nil {
+		return err
+	}
+	for _, key := range files {
+		err := source.Each(s, bucket, key, nil, func(items []map[string]interface{}) error {
+			for _, item := range items {
+				id, ok := table.KeyID(item, keyAttrs)
+				if !ok {
+					return fmt.Errorf("item %v in %s does not have all of the key attributes %v", table.Key(item, keyAttrs), key, keyAttrs)
+				}
+				b, err := json.Marshal(item)
+				if err != nil {
+					return err
+				}
+				if err := st.Add(extsort.Record{ID: id, Item: b}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge walks both sorted archives together and writes a change for every key which is not the same in both
+func merge(enc *json.Encoder, from, to *extsort.Unique, keyAttrs []string) (map[string]int, error) {
+	counts := map[string]int{}
+	write := func(typ string, r *extsort.Record, ch change) error {
+		var item map[string]interface{}
+		if err := json.Unmarshal(r.Item, &item); err != nil {
+			return err
+		}
+		ch.Type, ch.Key = typ, table.Key(item, keyAttrs)
+		counts[typ]++
+		return enc.Encode(ch)
+	}
+
+	a, err := from.Next()
+	if err != nil {
+		return nil, err
+	}
+	b, err := to.Next()
+	if err != nil {
+		return nil, err
+	}
+	for a != nil || b != nil {
+		switch {
+		case b == nil || (a != nil && a.ID < b.ID):
+			if err := write(Removed, a, change{Item: a.Item}); err != nil {
+				return nil, err
+			}
+			a, err = from.Next()
+		case a == nil || b.ID < a.ID:
+			if err := write(Added, b, change{Item: b.Item}); err != nil {
+				return nil, err
+			}
+			b, err = to.Next()
+		default:
+			if !bytes.Equal(a.Item, b.Item) {
+				changes, err := attributeChanges(a.Item, b.Item)
+				if err != nil {
+					return nil, err
+				}
+				if err := write(Modified, b, change{Changes: changes}); err != nil {
+					return nil, err
+				}
+			}
+			if a, err = from.Next(); err != nil {
+				return nil, err
+			}
+			b, err = to.Next()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// attributeChanges compares the top level attributes of two versions of an item. Both are json encoded with
+// sorted map keys so equal values have equal json.
+func attributeChanges(from, to json.RawMessage) ([]attributeChange, error) {
+	var a, b map[string]json.RawMessage
+	if err := json.Unmarshal(from, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &b); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []attributeChange
+	for _, name := range names {
+		if !bytes.Equal(a[name], b[name]) {
+			changes = append(changes, attributeChange{Attribute: name, From: a[name], To: b[name]})
+		}
+	}
+	return changes, nil
+}
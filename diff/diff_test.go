@@ -0,0 +1,96 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/SEEK-Jobs/dynamotools/extsort"
+	"github.com/SEEK-Jobs/dynamotools/table"
+)
+
+// unique sorts the items by id like an archive is read, two to a run so the merge crosses runs
+func unique(t *testing.T, items []map[string]interface{}) *extsort.Unique {
+	dir, err := ioutil.TempDir("", "dynamotools-diff-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	st := extsort.NewSorter(dir, 2)
+	for _, item := range items {
+		id, _ := table.KeyID(item, []string{"id"})
+		b, err := json.Marshal(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Add(extsort.Record{ID: id, Item: b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := st.Sorted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return extsort.NewUnique(m)
+}
+
+func TestMerge(t *testing.T) {
+	from := []map[string]interface{}{
+		{"id": "e", "n": 1.0},
+		{"id": "a", "n": 1.0},
+		{"id": "c", "n": 1.0, "old": true},
+		{"id": "b", "n": 1.0},
+	}
+	to := []map[string]interface{}{
+		{"id": "b", "n": 1.0},
+		{"id": "d", "n": 2.0},
+		{"id": "c", "n": 2.0, "new": "x"},
+		{"id": "f", "n": 3.0},
+	}
+	var buf bytes.Buffer
+	counts, err := merge(json.NewEncoder(&buf), unique(t, from), unique(t, to), []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"removed","key":{"id":"a"},"item":{"id":"a","n":1}}
+{"type":"modified","key":{"id":"c"},"changes":[{"attribute":"n","from":1,"to":2},{"attribute":"new","to":"x"},{"attribute":"old","from":true}]}
+{"type":"added","key":{"id":"d"},"item":{"id":"d","n":2}}
+{"type":"removed","key":{"id":"e"},"item":{"id":"e","n":1}}
+{"type":"added","key":{"id":"f"},"item":{"id":"f","n":3}}
+`
+	if buf.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+	if wantCounts := map[string]int{Added: 2, Removed: 2, Modified: 1}; !reflect.DeepEqual(counts, wantCounts) {
+		t.Errorf("counts %v, want %v", counts, wantCounts)
+	}
+}
+
+func TestMergeEmpty(t *testing.T) {
+	items := []map[string]interface{}{{"id": "a"}, {"id": "b"}}
+	tests := []struct {
+		name string
+		from []map[string]interface{}
+		to   []map[string]interface{}
+		want map[string]int
+	}{
+		{"both empty", nil, nil, map[string]int{}},
+		{"from empty", nil, items, map[string]int{Added: 2}},
+		{"to empty", items, nil, map[string]int{Removed: 2}},
+		{"same", items, items, map[string]int{}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		counts, err := merge(json.NewEncoder(&buf), unique(t, tt.from), unique(t, tt.to), []string{"id"})
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(counts, tt.want) {
+			t.Errorf("%s: counts %v, want %v", tt.name, counts, tt.want)
+		}
+	}
+}
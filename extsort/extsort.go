@@ -0,0 +1,214 @@
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Record is an item with the id of its key, items are kept as json so they can be spilled to disk as they are
+type Record struct {
+	ID   string          `json:"id"`
+	Item json.RawMessage `json:"item"`
+}
+
+// Sorter sorts records by id with an external merge sort. Up to maxRecords are sorted in memory at a time and
+// spilled to a run file in dir, the runs are then merged back together a record at a time.
+type Sorter struct {
+	mu         sync.Mutex
+	dir        string
+	maxRecords int
+	buffer     []Record
+	runs       []string
+}
+
+// NewSorter creates a sorter spilling runs of up to maxRecords to dir
+func NewSorter(dir string, maxRecords int) *Sorter {
+	return &Sorter{dir: dir, maxRecords: maxRecords}
+}
+
+// Add adds a record, it is safe to call from several goroutines
+func (s *Sorter) Add(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffer = append(s.buffer, r)
+	if len(s.buffer) >= s.maxRecords {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the sorted buffer to a new run file
+func (s *Sorter) spill() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	sort.SliceStable(s.buffer, func(i, j int) bool { return s.buffer[i].ID < s.buffer[j].ID })
+
+	f, err := ioutil.TempFile(s.dir, "run-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range s.buffer {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+// Sorted spills what is left and returns an iterator over every record in id order
+func (s *Sorter) Sorted() (*Merger, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.spill(); err != nil {
+		return nil, err
+	}
+	m := &Merger{}
+	for i, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		r := &run{file: f, dec: json.NewDecoder(bufio.NewReader(f)), order: i}
+		m.files = append(m.files, f)
+		if ok, err := r.advance(); err != nil {
+			m.Close()
+			return nil, err
+		} else if ok {
+			m.runs = append(m.runs, r)
+		}
+	}
+	heap.Init(&m.runs)
+	return m, nil
+}
+
+// run is a run file being merged, with its next record
+type run struct {
+	file  *os.File
+	dec   *json.Decoder
+	next  Record
+	order int
+}
+
+func (r *run) advance() (bool, error) {
+	r.next = Record{}
+	if err := r.dec.Decode(&r.next); err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runHeap orders the runs by their next id, and by the order they were written for equal ids
+type runHeap []*run
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].next.ID == h[j].next.ID {
+		return h[i].order < h[j].order
+	}
+	return h[i].next.ID < h[j].next.ID
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*run)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// Merger merges the run files into a single stream of records in id order
+type Merger struct {
+	runs  runHeap
+	files []*os.File
+}
+
+// Next returns the next record, false once every run has been read
+func (m *Merger) Next() (Record, bool, error) {
+	if len(m.runs) == 0 {
+		return Record{}, false, nil
+	}
+	r := m.runs[0]
+	rec := r.next
+	ok, err := r.advance()
+	if err != nil {
+		return Record{}, false, err
+	}
+	if ok {
+		heap.Fix(&m.runs, 0)
+	} else {
+		heap.Pop(&m.runs)
+	}
+	return rec, true, nil
+}
+
+// Close closes the run files
+func (m *Merger) Close() {
+	for _, f := range m.files {
+		f.Close()
+	}
+}
+
+// Unique reads the merged records with duplicate ids collapsed to the last one added
+type Unique struct {
+	m      *Merger
+	peeked *Record
+	done   bool
+	// Duplicates counts the records which were collapsed
+	Duplicates int64
+}
+
+// NewUnique reads the records of the merger once per id
+func NewUnique(m *Merger) *Unique {
+	return &Unique{m: m}
+}
+
+// Next returns the next record, nil once every record has been read
+func (u *Unique) Next() (*Record, error) {
+	if u.done {
+		return nil, nil
+	}
+	cur := u.peeked
+	if cur == nil {
+		r, ok, err := u.m.Next()
+		if err != nil || !ok {
+			u.done = err == nil
+			return nil, err
+		}
+		cur = &r
+	}
+	u.peeked = nil
+	for {
+		r, ok, err := u.m.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			u.done = true
+			return cur, nil
+		}
+		if r.ID != cur.ID {
+			u.peeked = &r
+			return cur, nil
+		}
+		u.Duplicates++
+		cur = &r
+	}
+}
@@ -0,0 +1,99 @@
+package extsort
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func sorted(t *testing.T, maxRecords int, records []Record) *Merger {
+	dir, err := ioutil.TempDir("", "dynamotools-extsort-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s := NewSorter(dir, maxRecords)
+	for _, r := range records {
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := s.Sorted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func record(id, item string) Record {
+	return Record{ID: id, Item: json.RawMessage(item)}
+}
+
+func TestSorter(t *testing.T) {
+	records := []Record{record("d", "1"), record("b", "2"), record("e", "3"), record("a", "4"), record("c", "5")}
+	for _, maxRecords := range []int{1, 2, 5, 100} {
+		m := sorted(t, maxRecords, records)
+		var ids []string
+		for {
+			r, ok, err := m.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			ids = append(ids, r.ID)
+		}
+		if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("%d a run: sorted %v, want %v", maxRecords, ids, want)
+		}
+	}
+}
+
+func TestSorterEmpty(t *testing.T) {
+	m := sorted(t, 10, nil)
+	if _, ok, err := m.Next(); ok || err != nil {
+		t.Errorf("an empty sorter returned a record, error %v", err)
+	}
+	if r, err := NewUnique(m).Next(); r != nil || err != nil {
+		t.Errorf("an empty sorter returned %v, error %v", r, err)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRecords int
+		records    []Record
+		want       []string
+		duplicates int64
+	}{
+		{"no duplicates", 2, []Record{record("b", "1"), record("a", "2")}, []string{"a:2", "b:1"}, 0},
+		{"in one run", 10, []Record{record("a", "1"), record("b", "2"), record("a", "3")}, []string{"a:3", "b:2"}, 1},
+		{"across runs", 1, []Record{record("a", "1"), record("b", "2"), record("a", "3"), record("a", "4")}, []string{"a:4", "b:2"}, 2},
+		{"last record", 2, []Record{record("a", "1"), record("c", "2"), record("c", "3")}, []string{"a:1", "c:3"}, 1},
+	}
+	for _, tt := range tests {
+		u := NewUnique(sorted(t, tt.maxRecords, tt.records))
+		var got []string
+		for {
+			r, err := u.Next()
+			if err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+			if r == nil {
+				break
+			}
+			got = append(got, r.ID+":"+string(r.Item))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: read %v, want %v", tt.name, got, tt.want)
+		}
+		if u.Duplicates != tt.duplicates {
+			t.Errorf("%s: %d duplicates, want %d", tt.name, u.Duplicates, tt.duplicates)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"fmt"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Filter keeps the items matching a jmespath where expression and reshapes them with a jmespath select expression
+type Filter struct {
+	where *jmespath.JMESPath
+	sel   *jmespath.JMESPath
+}
+
+// New compiles the where and select expressions, either of which can be empty.
+// It returns a nil filter when both are empty.
+func New(where, sel string) (*Filter, error) {
+	if where == "" && sel == "" {
+		return nil, nil
+	}
+
+	f := &Filter{}
+	var err error
+	if where != "" {
+		if f.where, err = jmespath.Compile(where); err != nil {
+			return nil, fmt.Errorf("invalid where expression %q: %v", where, err)
+		}
+	}
+	if sel != "" {
+		if f.sel, err = jmespath.Compile(sel); err != nil {
+			return nil, fmt.Errorf("invalid select expression %q: %v", sel, err)
+		}
+	}
+	return f, nil
+}
+
+// Apply returns the selected item and whether it matched the where expression.
+// A nil filter matches every item and returns it untouched.
+func (f *Filter) Apply(item map[string]interface{}) (map[string]interface{}, bool, error) {
+	if f == nil {
+		return item, true, nil
+	}
+
+	if f.where != nil {
+		res, err := f.where.Search(item)
+		if err != nil {
+			return nil, false, err
+		}
+		if !truthy(res) {
+			return nil, false, nil
+		}
+	}
+
+	if f.sel != nil {
+		res, err := f.sel.Search(item)
+		if err != nil {
+			return nil, false, err
+		}
+		selected, ok := res.(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("select expression returned %T instead of an object", res)
+		}
+		return selected, true, nil
+	}
+	return item, true, nil
+}
+
+// truthy follows the jmespath definition of false: null, false and empty strings, lists and objects.
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) != 0
+	case map[string]interface{}:
+		return len(t) != 0
+	}
+	return true
+}
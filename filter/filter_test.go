@@ -0,0 +1,86 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	item := map[string]interface{}{
+		"id":     "a",
+		"status": "open",
+		"n":      3.0,
+		"tags":   []interface{}{"x"},
+		"empty":  "",
+		"nested": map[string]interface{}{"deep": true},
+	}
+	tests := []struct {
+		name    string
+		where   string
+		sel     string
+		want    map[string]interface{}
+		wantOK  bool
+		wantErr bool
+	}{
+		{"no expressions", "", "", item, true, false},
+		{"where matches", "status == 'open'", "", item, true, false},
+		{"where does not match", "status == 'closed'", "", nil, false, false},
+		{"number comparison", "n > `2`", "", item, true, false},
+		{"nested", "nested.deep", "", item, true, false},
+		{"missing attribute is false", "missing", "", nil, false, false},
+		{"empty string is false", "empty", "", nil, false, false},
+		{"non empty list is true", "tags", "", item, true, false},
+		{"select", "", "{id: id, state: status}", map[string]interface{}{"id": "a", "state": "open"}, true, false},
+		{"where and select", "n == `3`", "{id: id}", map[string]interface{}{"id": "a"}, true, false},
+		{"select after where fails", "n == `4`", "{id: id}", nil, false, false},
+		{"select not an object", "", "id", nil, false, true},
+	}
+	for _, tt := range tests {
+		f, err := New(tt.where, tt.sel)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		got, ok, err := f.Apply(item)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if f, err := New("", ""); f != nil || err != nil {
+		t.Errorf("no expressions returned %v, %v, want a nil filter", f, err)
+	}
+	for _, tt := range []struct{ where, sel string }{{"status ==", ""}, {"", "{id: "}} {
+		if _, err := New(tt.where, tt.sel); err == nil {
+			t.Errorf("where %q select %q: accepted an invalid expression", tt.where, tt.sel)
+		}
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want bool
+	}{
+		{nil, false},
+		{false, false},
+		{true, true},
+		{"", false},
+		{"x", true},
+		{[]interface{}{}, false},
+		{[]interface{}{1.0}, true},
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"a": 1.0}, true},
+		{0.0, true},
+	}
+	for _, tt := range tests {
+		if got := truthy(tt.v); got != tt.want {
+			t.Errorf("truthy(%#v) is %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
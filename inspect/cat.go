@@ -0,0 +1,398 @@
+package inspect
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// output formats of cat
+const (
+	OutputJSON     = "json"
+	OutputJSONL    = "jsonl"
+	OutputDynamo   = "dynamodb"
+	OutputTable    = "table"
+	tableCellWidth = 40
+	// tableSampleRows is how many rows are held to work out the columns and their widths before the table is streamed
+	tableSampleRows = 1000
+)
+
+// CatConfig provides the configuration for printing the items of an archive
+type CatConfig struct {
+	Region      string
+	Bucket      string
+	Source      string
+	Where       string
+	Select      string
+	Limit       int
+	Output      string
+	SummaryOnly bool
+}
+
+// Cat streams the items of the archive to stdout, after printing the summary of its manifest if it has one
+func Cat(c *CatConfig) error {
+	p, err := newPrinter(os.Stdout, c.Output)
+	if err != nil {
+		return err
+	}
+	f, err := filter.New(c.Where, c.Select)
+	if err != nil {
+		return err
+	}
+
+	s := awssession.New(c.Region)
+	svc := s3.New(s)
+	bucket, key := source.ParseURI(c.Source, c.Bucket)
+	if bucket == "" {
+		return fmt.Errorf("missing bucket for %s", c.Source)
+	}
+	if manifest.IsManifest(key) {
+		m, err := manifest.Read(svc, bucket, key)
+		if err != nil {
+			return err
+		}
+		printSummary(os.Stderr, m)
+		if !c.SummaryOnly && m.Format == archive.FormatParquet {
+			return fmt.Errorf("cat can not print parquet archive %s, query it with athena or a parquet reader", c.Source)
+		}
+	}
+	if c.SummaryOnly {
+		return nil
+	}
+
+	files, err := source.Files(svc, bucket, key)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if isParquet(file) {
+			return fmt.Errorf("cat can not print parquet archive file %s, query it with athena or a parquet reader", file)
+		}
+	}
+	printed := 0
+	for _, file := range files {
+		err := source.Stream(svc, bucket, file, nil, func(items []map[string]interface{}) error {
+			var kept []map[string]interface{}
+			for _, item := range items {
+				item, ok, err := f.Apply(item)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+				kept = append(kept, item)
+				if c.Limit > 0 && printed+len(kept) == c.Limit {
+					break
+				}
+			}
+			printed += len(kept)
+			if err := p.print(kept); err != nil {
+				return err
+			}
+			if c.Limit > 0 && printed == c.Limit {
+				return source.ErrStop
+			}
+			return nil
+		})
+		if err == source.ErrStop {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.close()
+}
+
+// isParquet tells a parquet archive file by its key, the restore decoders can only say it is not something they read
+func isParquet(key string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(key, ".gz"), ".parquet")
+}
+
+// printSummary writes what the manifest says about the archive
+func printSummary(w io.Writer, m *manifest.Manifest) {
+	var items, bytes int64
+	for _, p := range m.Parts {
+		items += p.Items
+		bytes += p.Bytes
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "table\t%s\n", m.Table)
+	fmt.Fprintf(tw, "kind\t%s\n", m.Kind)
+	fmt.Fprintf(tw, "format\t%s\n", m.Format)
+	fmt.Fprintf(tw, "status\t%s\n", m.Status)
+	fmt.Fprintf(tw, "started\t%s\n", m.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(tw, "completed\t%s (%s)\n", m.CompletedAt.Format(time.RFC3339), m.CompletedAt.Sub(m.StartedAt))
+	fmt.Fprintf(tw, "parts\t%d\n", len(m.Parts))
+	fmt.Fprintf(tw, "items\t%d\n", items)
+	fmt.Fprintf(tw, "bytes\t%d\n", bytes)
+	if m.Segments != 0 {
+		fmt.Fprintf(tw, "segments\t%d, failed %v\n", m.Segments, m.FailedSegments)
+	}
+	if m.PartitionBy != "" {
+		fmt.Fprintf(tw, "partitioned by\t%s, %d partitions\n", m.PartitionBy, len(m.Partitions))
+	}
+	tw.Flush()
+}
+
+// printer writes items in one of the output formats
+type printer struct {
+	w      io.Writer
+	output string
+	first  bool
+	// rows holds the cells of the first rows of the table output, which set its columns and their widths
+	rows    []map[string]string
+	columns []string
+	widths  []int
+	// dropped are the attributes which first turn up once the columns are set, so have no column
+	dropped map[string]bool
+}
+
+func newPrinter(w io.Writer, output string) (*printer, error) {
+	switch output {
+	case "", OutputJSON:
+		output = OutputJSON
+	case OutputJSONL, OutputDynamo, OutputTable:
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected json, jsonl, dynamodb or table", output)
+	}
+	return &printer{w: w, output: output, first: true, dropped: map[string]bool{}}, nil
+}
+
+func (p *printer) print(items []map[string]interface{}) error {
+	switch p.output {
+	case OutputTable:
+		return p.table(items)
+	case OutputJSON:
+		for _, item := range items {
+			b, err := json.MarshalIndent(item, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			sep := ",\n  "
+			if p.first {
+				sep = "[\n  "
+				p.first = false
+			}
+			if _, err := fmt.Fprintf(p.w, "%s%s", sep, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	enc := json.NewEncoder(p.w)
+	for _, item := range items {
+		var v interface{} = item
+		if p.output == OutputDynamo {
+			av, err := dynamodbattribute.MarshalMap(item)
+			if err != nil {
+				return err
+			}
+			v = dynamoJSON(&dynamodb.AttributeValue{M: av})["M"]
+		}
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *printer) close() error {
+	if p.output == OutputTable {
+		if err := p.startTable(); err != nil {
+			return err
+		}
+		if len(p.dropped) > 0 {
+			names := make([]string, 0, len(p.dropped))
+			for name := range p.dropped {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			log.Printf("attributes %s first turned up after the first %d rows and have no column, print them with --output jsonl", strings.Join(names, ", "), tableSampleRows)
+		}
+		return nil
+	}
+	if p.output != OutputJSON {
+		return nil
+	}
+	end := "\n]\n"
+	if p.first {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(p.w, end)
+	return err
+}
+
+// table holds on to the cells of the first rows until there are enough of them to set the columns, then writes
+// those and every later row as it comes
+func (p *printer) table(items []map[string]interface{}) error {
+	for _, item := range items {
+		row := make(map[string]string, len(item))
+		for name, v := range item {
+			row[name] = cell(v)
+		}
+		if p.columns == nil {
+			p.rows = append(p.rows, row)
+			if len(p.rows) == tableSampleRows {
+				if err := p.startTable(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for name := range row {
+			if !p.dropped[name] && !p.hasColumn(name) {
+				p.dropped[name] = true
+			}
+		}
+		if err := p.writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startTable sets the columns, every attribute of the held rows in name order, each as wide as its widest cell,
+// and writes the header and the held rows
+func (p *printer) startTable() error {
+	if p.columns != nil || len(p.rows) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, row := range p.rows {
+		for name := range row {
+			if !seen[name] {
+				seen[name] = true
+				p.columns = append(p.columns, name)
+			}
+		}
+	}
+	sort.Strings(p.columns)
+	p.widths = make([]int, len(p.columns))
+	for i, name := range p.columns {
+		p.widths[i] = utf8.RuneCountInString(name)
+		for _, row := range p.rows {
+			if n := utf8.RuneCountInString(row[name]); n > p.widths[i] {
+				p.widths[i] = n
+			}
+		}
+	}
+
+	header := make(map[string]string, len(p.columns))
+	for _, name := range p.columns {
+		header[name] = name
+	}
+	if err := p.writeRow(header); err != nil {
+		return err
+	}
+	for _, row := range p.rows {
+		if err := p.writeRow(row); err != nil {
+			return err
+		}
+	}
+	p.rows = nil
+	return nil
+}
+
+func (p *printer) hasColumn(name string) bool {
+	i := sort.SearchStrings(p.columns, name)
+	return i < len(p.columns) && p.columns[i] == name
+}
+
+// writeRow pads every cell but the last to the width of its column and two spaces, a later cell wider than the
+// held ones pushes the rest of its row along
+func (p *printer) writeRow(row map[string]string) error {
+	var b strings.Builder
+	last := len(p.columns) - 1
+	for i, name := range p.columns {
+		s := row[name]
+		b.WriteString(s)
+		if i < last {
+			pad := p.widths[i] - utf8.RuneCountInString(s)
+			if pad < 0 {
+				pad = 0
+			}
+			b.WriteString(strings.Repeat(" ", pad+2))
+		}
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(p.w, b.String())
+	return err
+}
+
+func cell(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = v
+	default:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	s = strings.NewReplacer("\t", " ", "\n", " ").Replace(s)
+	if utf8.RuneCountInString(s) > tableCellWidth {
+		s = string([]rune(s)[:tableCellWidth-3]) + "..."
+	}
+	return s
+}
+
+// dynamoJSON converts an attribute value to the DynamoDB JSON the aws cli prints, with just the type which is set
+func dynamoJSON(av *dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case av.S != nil:
+		return map[string]interface{}{"S": *av.S}
+	case av.N != nil:
+		return map[string]interface{}{"N": *av.N}
+	case av.B != nil:
+		return map[string]interface{}{"B": base64.StdEncoding.EncodeToString(av.B)}
+	case av.BOOL != nil:
+		return map[string]interface{}{"BOOL": *av.BOOL}
+	case av.NULL != nil:
+		return map[string]interface{}{"NULL": true}
+	case av.M != nil:
+		m := map[string]interface{}{}
+		for k, v := range av.M {
+			m[k] = dynamoJSON(v)
+		}
+		return map[string]interface{}{"M": m}
+	case av.L != nil:
+		l := make([]interface{}, len(av.L))
+		for i, v := range av.L {
+			l[i] = dynamoJSON(v)
+		}
+		return map[string]interface{}{"L": l}
+	case av.SS != nil:
+		return map[string]interface{}{"SS": aws.StringValueSlice(av.SS)}
+	case av.NS != nil:
+		return map[string]interface{}{"NS": aws.StringValueSlice(av.NS)}
+	case av.BS != nil:
+		bs := make([]string, len(av.BS))
+		for i, b := range av.BS {
+			bs[i] = base64.StdEncoding.EncodeToString(b)
+		}
+		return map[string]interface{}{"BS": bs}
+	}
+	return map[string]interface{}{"NULL": true}
+}
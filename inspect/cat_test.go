@@ -0,0 +1,112 @@
+package inspect
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPrinter(t *testing.T) {
+	chunks := [][]map[string]interface{}{
+		{{"id": "a", "n": 1.0}},
+		{{"id": "bbbbbb", "late": true}},
+	}
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{OutputTable, "id      late  n\na             1\nbbbbbb  true  \n"},
+		{OutputJSONL, "{\"id\":\"a\",\"n\":1}\n{\"id\":\"bbbbbb\",\"late\":true}\n"},
+		{OutputJSON, "[\n  {\n    \"id\": \"a\",\n    \"n\": 1\n  },\n  {\n    \"id\": \"bbbbbb\",\n    \"late\": true\n  }\n]\n"},
+		{OutputDynamo, "{\"id\":{\"S\":\"a\"},\"n\":{\"N\":\"1\"}}\n{\"id\":{\"S\":\"bbbbbb\"},\"late\":{\"BOOL\":true}}\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		p, err := newPrinter(&buf, tt.output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, items := range chunks {
+			if err := p.print(items); err != nil {
+				t.Fatalf("%s: %s", tt.output, err)
+			}
+		}
+		if err := p.close(); err != nil {
+			t.Fatalf("%s: %s", tt.output, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: printed\n%q\nwant\n%q", tt.output, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestPrinterStreamsTable(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := newPrinter(&buf, OutputTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := make([]map[string]interface{}, tableSampleRows)
+	for i := range sample {
+		sample[i] = map[string]interface{}{"id": "a"}
+	}
+	if err := p.print(sample); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != tableSampleRows+1 {
+		t.Errorf("printed %d lines once the sample was full, want %d", n, tableSampleRows+1)
+	}
+
+	buf.Reset()
+	if err := p.print([]map[string]interface{}{{"id": "bbb", "late": true}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "bbb\n" {
+		t.Errorf("printed %q after the sample, want %q", buf.String(), "bbb\n")
+	}
+	if !p.dropped["late"] {
+		t.Errorf("late attribute was not counted as dropped")
+	}
+}
+
+func TestCell(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"string", "a\tb\nc", "a b c"},
+		{"number", 1.5, "1.5"},
+		{"ascii", strings.Repeat("a", 50), strings.Repeat("a", 37) + "..."},
+		{"multibyte", strings.Repeat("é", 50), strings.Repeat("é", 37) + "..."},
+		{"fits", strings.Repeat("é", 40), strings.Repeat("é", 40)},
+	}
+	for _, tt := range tests {
+		got := cell(tt.v)
+		if got != tt.want {
+			t.Errorf("%s: cell %q, want %q", tt.name, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%s: cell %q is not valid utf-8", tt.name, got)
+		}
+	}
+}
+
+func TestIsParquet(t *testing.T) {
+	tests := map[string]bool{
+		"backups/jobs/part-0000.parquet":    true,
+		"backups/jobs/part-0000.parquet.gz": true,
+		"backups/jobs/part-0000.json.gz":    false,
+		"backups/jobs/part-0000.csv":        false,
+	}
+	for key, want := range tests {
+		if got := isParquet(key); got != want {
+			t.Errorf("%s: isParquet %t, want %t", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package inspect
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// sizeSubBuckets is how many buckets each power of two is split into, so a bucket is within 1% of its sizes
+const sizeSubBuckets = 128
+
+// sizeHistogram counts the item sizes in log linear buckets, exact below 2*sizeSubBuckets bytes and within 1%
+// above, so the percentiles of any number of items are estimated in a few KB.
+type sizeHistogram struct {
+	counts []int64
+	n      int64
+	min    int64
+	max    int64
+}
+
+func sizeBucket(size int64) int {
+	if size < 2*sizeSubBuckets {
+		return int(size)
+	}
+	shift := bits.Len64(uint64(size)) - 8
+	return 2*sizeSubBuckets + (shift-1)*sizeSubBuckets + int(size>>uint(shift)) - sizeSubBuckets
+}
+
+// sizeBucketMax is the largest size which falls in the bucket
+func sizeBucketMax(i int) int64 {
+	if i < 2*sizeSubBuckets {
+		return int64(i)
+	}
+	i -= 2 * sizeSubBuckets
+	shift := uint(i/sizeSubBuckets + 1)
+	return (int64(i%sizeSubBuckets+sizeSubBuckets)+1)<<shift - 1
+}
+
+func (h *sizeHistogram) add(size int64) {
+	if size < 0 {
+		size = 0
+	}
+	i := sizeBucket(size)
+	if i >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, i+1-len(h.counts))...)
+	}
+	h.counts[i]++
+	if h.n == 0 || size < h.min {
+		h.min = size
+	}
+	if size > h.max {
+		h.max = size
+	}
+	h.n++
+}
+
+// percentile returns the size which p percent of the items are no bigger than, to within 1%
+func (h *sizeHistogram) percentile(p int) int64 {
+	rank := int64(math.Ceil(float64(p) / 100 * float64(h.n)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		if seen += c; seen >= rank {
+			if v := sizeBucketMax(i); v < h.max {
+				return v
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// spaceSaving finds the partition keys with the most items in a fixed number of counters. Once every counter is
+// in use a new key takes over the counter with the fewest items, counting on from them, so every key with more
+// than 1/capacity of the items is kept and a count is over by at most its Error.
+type spaceSaving struct {
+	capacity int
+	counters map[string]*hitCounter
+	byItems  hitHeap
+}
+
+type hitCounter struct {
+	PartitionStats
+	index int
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{capacity: capacity, counters: map[string]*hitCounter{}}
+}
+
+func (s *spaceSaving) add(key string, size int64) {
+	c, ok := s.counters[key]
+	switch {
+	case ok:
+	case len(s.counters) < s.capacity:
+		c = &hitCounter{PartitionStats: PartitionStats{Value: key}}
+		s.counters[key] = c
+		heap.Push(&s.byItems, c)
+	default:
+		c = s.byItems[0]
+		delete(s.counters, c.Value)
+		c.Value = key
+		c.Error = c.Items
+		s.counters[key] = c
+	}
+	c.Items++
+	c.Bytes += size
+	heap.Fix(&s.byItems, c.index)
+}
+
+// top returns the n keys with the most items, the most first
+func (s *spaceSaving) top(n int) []PartitionStats {
+	hot := make([]PartitionStats, 0, len(s.counters))
+	for _, c := range s.counters {
+		hot = append(hot, c.PartitionStats)
+	}
+	sortPartitions(hot)
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	return hot
+}
+
+// hitHeap is a min heap of the counters by items
+type hitHeap []*hitCounter
+
+func (h hitHeap) Len() int           { return len(h) }
+func (h hitHeap) Less(i, j int) bool { return h[i].Items < h[j].Items }
+func (h hitHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *hitHeap) Push(x interface{}) {
+	c := x.(*hitCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *hitHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// hllPrecision gives 2^14 registers, which count the distinct keys to within about 1%
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct partition keys in fixed memory
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(key string) {
+	f := fnv.New64a()
+	f.Write([]byte(key))
+	x := mix64(f.Sum64())
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// count is the standard estimate, with linear counting while many registers are still empty
+func (h *hyperLogLog) count() int64 {
+	m := float64(len(h.registers))
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros != 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// mix64 spreads the bits of the fnv hash, whose high bits vary little between similar short keys
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
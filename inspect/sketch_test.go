@@ -0,0 +1,71 @@
+package inspect
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	var h sizeHistogram
+	for size := int64(1); size <= 100000; size++ {
+		h.add(size)
+	}
+	if h.min != 1 || h.max != 100000 {
+		t.Errorf("min %d max %d, want 1 and 100000", h.min, h.max)
+	}
+	for _, p := range []int{1, 50, 90, 99, 100} {
+		want := float64(p) * 1000
+		if got := float64(h.percentile(p)); math.Abs(got-want)/want > 0.01 {
+			t.Errorf("p%d is %.0f, want %.0f within 1%%", p, got, want)
+		}
+	}
+}
+
+func TestSizeBucket(t *testing.T) {
+	for size := int64(0); size < 1<<20; size++ {
+		i := sizeBucket(size)
+		if max := sizeBucketMax(i); size > max || (i > 0 && size <= sizeBucketMax(i-1)) {
+			t.Fatalf("%d is in bucket %d up to %d", size, i, max)
+		}
+	}
+}
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving(10)
+	// a and b are hot, the rest are seen once each, more keys than there are counters
+	for i := 0; i < 1000; i++ {
+		s.add("a", 10)
+		if i%2 == 0 {
+			s.add("b", 1)
+		}
+		s.add(fmt.Sprintf("cold%d", i), 1)
+	}
+	top := s.top(2)
+	if len(top) != 2 || top[0].Value != "a" || top[1].Value != "b" {
+		t.Fatalf("top %v, want a then b", top)
+	}
+	for _, p := range top {
+		want := map[string]int64{"a": 1000, "b": 500}[p.Value]
+		if p.Items < want || p.Items-p.Error > want {
+			t.Errorf("%s: %d items with error %d, want %d", p.Value, p.Items, p.Error, want)
+		}
+	}
+	if len(s.counters) != 10 {
+		t.Errorf("%d counters, want 10", len(s.counters))
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.add(fmt.Sprintf("key%d", i))
+			h.add(fmt.Sprintf("key%d", i))
+		}
+		got := h.count()
+		if math.Abs(float64(got)-float64(n)) > 0.02*float64(n) {
+			t.Errorf("%d distinct counted as %d", n, got)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package inspect
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// output formats of stats
+const (
+	OutputText = "text"
+)
+
+// partitionCounters is how many partition keys are counted at once to find the hot ones, any key with more than
+// 1/partitionCounters of the items is always found
+const partitionCounters = 10000
+
+// previewLength is how much of the json of an item is kept to tell the largest items apart without a key
+const previewLength = 80
+
+// sizeBuckets are the upper bounds of the item size histogram, the largest dynamodb item is 400KB
+var sizeBuckets = []int64{100, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 128 << 10, 256 << 10, 400 << 10}
+
+// StatsConfig provides the configuration for profiling a table or an archive
+type StatsConfig struct {
+	Region         string
+	TableName      string
+	Bucket         string
+	Source         string
+	Keys           string
+	ScanPartitions int
+	ScanLimit      int
+	Readers        int
+	Top            int
+	Output         string
+}
+
+// Stats is the profile of the items of a table or an archive
+type Stats struct {
+	Items          int64             `json:"items"`
+	Bytes          int64             `json:"bytes"`
+	Size           SizeStats         `json:"size"`
+	Attributes     []AttributeStats  `json:"attributes"`
+	Largest        []ItemSize        `json:"largest"`
+	PartitionKey   string            `json:"partitionKey,omitempty"`
+	PartitionCount int64             `json:"partitionCount,omitempty"`
+	HotPartitions  []PartitionStats  `json:"hotPartitions,omitempty"`
+	Histogram      []HistogramBucket `json:"histogram"`
+	Types          map[string]int64  `json:"types"`
+	presence       map[string]*AttributeStats
+}
+
+// SizeStats summarises the distribution of the item sizes in bytes
+type SizeStats struct {
+	Min  int64   `json:"min"`
+	Max  int64   `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int64   `json:"p50"`
+	P90  int64   `json:"p90"`
+	P99  int64   `json:"p99"`
+}
+
+// HistogramBucket counts the items no bigger than UpTo bytes and bigger than the previous bucket
+type HistogramBucket struct {
+	UpTo  int64 `json:"upTo"`
+	Items int64 `json:"items"`
+}
+
+// AttributeStats is how often a top level attribute is present and with which types
+type AttributeStats struct {
+	Name    string           `json:"name"`
+	Items   int64            `json:"items"`
+	Percent float64          `json:"percent"`
+	Types   map[string]int64 `json:"types"`
+}
+
+// ItemSize is the key and size of one of the largest items, or the start of its json when the key is not known
+type ItemSize struct {
+	Key     map[string]interface{} `json:"key,omitempty"`
+	Preview string                 `json:"preview,omitempty"`
+	Size    int64                  `json:"size"`
+}
+
+// PartitionStats is the number of items and bytes under a partition key value. Items and Bytes can be over by up
+// to Error items and their bytes, the items of other keys counted before this one took over their counter.
+type PartitionStats struct {
+	Value string `json:"value"`
+	Items int64  `json:"items"`
+	Bytes int64  `json:"bytes"`
+	Error int64  `json:"error,omitempty"`
+}
+
+// collector gathers the stats of the pages handed to it by the scanners or readers, in fixed memory however many
+// items there are
+type collector struct {
+	mu         sync.Mutex
+	keyAttrs   []string
+	top        int
+	stats      *Stats
+	sizes      sizeHistogram
+	largest    itemSizeHeap
+	partitions *spaceSaving
+	distinct   *hyperLogLog
+}
+
+func newCollector(keyAttrs []string, top int) *collector {
+	counters := partitionCounters
+	if top > counters {
+		counters = top
+	}
+	histogram := make([]HistogramBucket, len(sizeBuckets))
+	for i, upTo := range sizeBuckets {
+		histogram[i].UpTo = upTo
+	}
+	return &collector{
+		keyAttrs:   keyAttrs,
+		top:        top,
+		stats:      &Stats{Types: map[string]int64{}, Histogram: histogram, presence: map[string]*AttributeStats{}},
+		partitions: newSpaceSaving(counters),
+		distinct:   newHyperLogLog(),
+	}
+}
+
+func (c *collector) add(items []map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range items {
+		size := itemSize(item)
+		c.stats.Items++
+		c.stats.Bytes += size
+		c.sizes.add(size)
+		i := sort.Search(len(sizeBuckets), func(i int) bool { return sizeBuckets[i] >= size })
+		if i == len(sizeBuckets) {
+			i--
+		}
+		c.stats.Histogram[i].Items++
+
+		for name, v := range item {
+			a, ok := c.stats.presence[name]
+			if !ok {
+				a = &AttributeStats{Name: name, Types: map[string]int64{}}
+				c.stats.presence[name] = a
+			}
+			typ := attributeType(v)
+			a.Items++
+			a.Types[typ]++
+			c.stats.Types[typ]++
+		}
+
+		if c.top > 0 && (c.largest.Len() < c.top || size > c.largest[0].Size) {
+			heap.Push(&c.largest, c.itemSize(item, size))
+			if c.largest.Len() > c.top {
+				heap.Pop(&c.largest)
+			}
+		}
+		if len(c.keyAttrs) == 0 {
+			continue
+		}
+		if id, ok := table.KeyID(item, c.keyAttrs[:1]); ok {
+			c.partitions.add(id, size)
+			c.distinct.add(id)
+		}
+	}
+	return nil
+}
+
+// itemSize identifies one of the largest items by its key, or by the start of its json without key attributes
+func (c *collector) itemSize(item map[string]interface{}, size int64) ItemSize {
+	if len(c.keyAttrs) != 0 {
+		return ItemSize{Key: table.Key(item, c.keyAttrs), Size: size}
+	}
+	b, _ := json.Marshal(item)
+	if len(b) > previewLength {
+		n := previewLength - 3
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		b = append(b[:n], "..."...)
+	}
+	return ItemSize{Preview: string(b), Size: size}
+}
+
+// result sorts what was collected into the stats
+func (c *collector) result() *Stats {
+	s := c.stats
+	if n := c.sizes.n; n != 0 {
+		s.Size = SizeStats{
+			Min:  c.sizes.min,
+			Max:  c.sizes.max,
+			Mean: float64(s.Bytes) / float64(n),
+			P50:  c.sizes.percentile(50),
+			P90:  c.sizes.percentile(90),
+			P99:  c.sizes.percentile(99),
+		}
+	}
+
+	for _, a := range s.presence {
+		a.Percent = 100 * float64(a.Items) / float64(s.Items)
+		s.Attributes = append(s.Attributes, *a)
+	}
+	sort.Slice(s.Attributes, func(i, j int) bool {
+		if s.Attributes[i].Items != s.Attributes[j].Items {
+			return s.Attributes[i].Items > s.Attributes[j].Items
+		}
+		return s.Attributes[i].Name < s.Attributes[j].Name
+	})
+
+	for c.largest.Len() != 0 {
+		s.Largest = append([]ItemSize{heap.Pop(&c.largest).(ItemSize)}, s.Largest...)
+	}
+
+	if len(c.keyAttrs) != 0 {
+		s.PartitionKey = c.keyAttrs[0]
+		s.PartitionCount = c.distinct.count()
+		s.HotPartitions = c.partitions.top(c.top)
+	}
+	return s
+}
+
+// sortPartitions orders the partitions by items, the most first
+func sortPartitions(partitions []PartitionStats) {
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Items != partitions[j].Items {
+			return partitions[i].Items > partitions[j].Items
+		}
+		return partitions[i].Value < partitions[j].Value
+	})
+}
+
+// itemSizeHeap is a min heap so the smallest of the largest items is dropped first
+type itemSizeHeap []ItemSize
+
+func (h itemSizeHeap) Len() int            { return len(h) }
+func (h itemSizeHeap) Less(i, j int) bool  { return h[i].Size < h[j].Size }
+func (h itemSizeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *itemSizeHeap) Push(x interface{}) { *h = append(*h, x.(ItemSize)) }
+func (h *itemSizeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// attributeType returns the dynamodb type of a decoded value
+func attributeType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "S"
+	case float64, dynamodbattribute.Number:
+		return "N"
+	case bool:
+		return "BOOL"
+	case []byte:
+		return "B"
+	case map[string]interface{}:
+		return "M"
+	case []interface{}:
+		return "L"
+	case []string:
+		return "SS"
+	case []float64:
+		return "NS"
+	case [][]byte:
+		return "BS"
+	case dynamodbattribute.Marshaler:
+		av := &dynamodb.AttributeValue{}
+		if err := v.MarshalDynamoDBAttributeValue(av); err == nil {
+			switch {
+			case av.SS != nil:
+				return "SS"
+			case av.NS != nil:
+				return "NS"
+			case av.BS != nil:
+				return "BS"
+			}
+		}
+	}
+	return "unknown"
+}
+
+// itemSize estimates the size dynamodb bills the item as, the length of every attribute name plus its value
+func itemSize(item map[string]interface{}) int64 {
+	var size int64
+	for name, v := range item {
+		size += int64(len(name)) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v interface{}) int64 {
+	switch v := v.(type) {
+	case nil, bool:
+		return 1
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case float64:
+		return numberSize(strconv.FormatFloat(v, 'e', -1, 64))
+	case dynamodbattribute.Number:
+		return numberSize(string(v))
+	case map[string]interface{}:
+		size := int64(3)
+		for name, e := range v {
+			size += int64(len(name)) + valueSize(e) + 1
+		}
+		return size
+	case []interface{}:
+		size := int64(3)
+		for _, e := range v {
+			size += valueSize(e) + 1
+		}
+		return size
+	case []string:
+		var size int64
+		for _, e := range v {
+			size += int64(len(e))
+		}
+		return size
+	case []float64:
+		var size int64
+		for _, e := range v {
+			size += numberSize(strconv.FormatFloat(e, 'e', -1, 64))
+		}
+		return size
+	case [][]byte:
+		var size int64
+		for _, e := range v {
+			size += int64(len(e))
+		}
+		return size
+	}
+	if m, ok := v.(dynamodbattribute.Marshaler); ok {
+		av := &dynamodb.AttributeValue{}
+		if err := m.MarshalDynamoDBAttributeValue(av); err == nil {
+			var size int64
+			for _, s := range av.SS {
+				size += int64(len(*s))
+			}
+			for _, n := range av.NS {
+				size += numberSize(*n)
+			}
+			for _, b := range av.BS {
+				size += int64(len(b))
+			}
+			return size
+		}
+	}
+	b, _ := json.Marshal(v)
+	return int64(len(b))
+}
+
+// numberSize is a byte per two significant digits plus one, of a number written in decimal or e notation
+func numberSize(n string) int64 {
+	mantissa := strings.SplitN(strings.ToLower(n), "e", 2)[0]
+	digits := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, mantissa), "0")
+	return int64((len(digits)+1)/2 + 1)
+}
+
+// Profile collects the stats of the archive when a source is given, otherwise of the table, and prints them
+func Profile(c *StatsConfig) error {
+	s := awssession.New(c.Region)
+	if c.Readers < 1 {
+		c.Readers = 1
+	}
+	if c.Output == "" {
+		c.Output = OutputText
+	}
+	if c.Output != OutputText && c.Output != OutputJSON {
+		return fmt.Errorf("unknown output %q, expected text or json", c.Output)
+	}
+
+	var keyAttrs []string
+	if c.TableName != "" {
+		var err error
+		if keyAttrs, err = table.KeySchema(dynamodb.New(s), c.TableName); err != nil {
+			return err
+		}
+	}
+	if c.Keys != "" {
+		keyAttrs = strings.Split(c.Keys, ",")
+	}
+	col := newCollector(keyAttrs, c.Top)
+
+	if c.Source == "" {
+		log.Printf("scanning %s", c.TableName)
+		if err := archive.ScanTable(dynamodb.New(s), c.TableName, c.ScanPartitions, c.ScanLimit, col.add); err != nil {
+			return err
+		}
+	} else {
+		bucket, key := source.ParseURI(c.Source, c.Bucket)
+		if bucket == "" {
+			return fmt.Errorf("missing bucket for %s", c.Source)
+		}
+		files, err := source.Files(s3.New(s), bucket, key)
+		if err != nil {
+			return err
+		}
+		var grp errgroup.Group
+		sem := make(chan struct{}, c.Readers)
+		for _, file := range files {
+			file := file
+			grp.Go(func() error {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				return source.Each(s, bucket, file, nil, col.add)
+			})
+		}
+		if err := grp.Wait(); err != nil {
+			return err
+		}
+	}
+
+	stats := col.result()
+	if c.Output == OutputJSON {
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", b)
+		return err
+	}
+	return printStats(os.Stdout, stats)
+}
+
+// printStats writes the stats as aligned sections
+func printStats(w io.Writer, s *Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "items\t%d\n", s.Items)
+	fmt.Fprintf(tw, "bytes\t%d\n", s.Bytes)
+	fmt.Fprintf(tw, "item size\tmin %d, mean %.0f, p50 %d, p90 %d, p99 %d, max %d\n",
+		s.Size.Min, s.Size.Mean, s.Size.P50, s.Size.P90, s.Size.P99, s.Size.Max)
+
+	fmt.Fprintf(tw, "\nsize up to\titems\n")
+	for _, b := range s.Histogram {
+		fmt.Fprintf(tw, "%s\t%d\n", humanBytes(b.UpTo), b.Items)
+	}
+
+	fmt.Fprintf(tw, "\nattribute\tpresent\ttypes\n")
+	for _, a := range s.Attributes {
+		fmt.Fprintf(tw, "%s\t%d (%.1f%%)\t%s\n", a.Name, a.Items, a.Percent, typeCounts(a.Types))
+	}
+	fmt.Fprintf(tw, "all\t\t%s\n", typeCounts(s.Types))
+
+	if len(s.Largest) != 0 {
+		fmt.Fprintf(tw, "\nlargest items\tbytes\n")
+		for _, l := range s.Largest {
+			id := l.Preview
+			if l.Key != nil {
+				b, _ := json.Marshal(l.Key)
+				id = string(b)
+			}
+			fmt.Fprintf(tw, "%s\t%d\n", id, l.Size)
+		}
+	}
+	if s.PartitionKey != "" {
+		fmt.Fprintf(tw, "\n%s (about %d distinct)\titems\tbytes\n", s.PartitionKey, s.PartitionCount)
+		for _, p := range s.HotPartitions {
+			items := strconv.FormatInt(p.Items, 10)
+			if p.Error != 0 {
+				items = fmt.Sprintf("%d (-%d)", p.Items, p.Error)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", cell(p.Value), items, p.Bytes)
+		}
+	}
+	return tw.Flush()
+}
+
+func typeCounts(types map[string]int64) string {
+	var names []string
+	for typ := range types {
+		names = append(names, typ)
+	}
+	sort.Strings(names)
+	counts := make([]string, len(names))
+	for i, typ := range names {
+		counts[i] = fmt.Sprintf("%s %d", typ, types[typ])
+	}
+	return strings.Join(counts, ", ")
+}
+
+func humanBytes(n int64) string {
+	if n < 1<<10 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%dKB", n>>10)
+}
@@ -0,0 +1,54 @@
+package inspect
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyAttrs []string
+		wantKey  bool
+	}{
+		{"keys", []string{"id"}, true},
+		{"no keys", nil, false},
+	}
+	for _, tt := range tests {
+		c := newCollector(tt.keyAttrs, 2)
+		items := []map[string]interface{}{
+			{"id": "a", "body": strings.Repeat("x", 200)},
+			{"id": "a", "body": "y"},
+			{"id": "b", "body": strings.Repeat("z", 50)},
+		}
+		if err := c.add(items); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		s := c.result()
+		if s.Items != 3 {
+			t.Errorf("%s: %d items, want 3", tt.name, s.Items)
+		}
+		if len(s.Largest) != 2 || s.Largest[0].Size <= s.Largest[1].Size {
+			t.Fatalf("%s: largest %v, want two biggest first", tt.name, s.Largest)
+		}
+		if got := s.Largest[0].Key != nil; got != tt.wantKey {
+			t.Errorf("%s: largest has key %v, want %v", tt.name, got, tt.wantKey)
+		}
+		if !tt.wantKey && !strings.HasSuffix(s.Largest[0].Preview, "...") {
+			t.Errorf("%s: preview %q not truncated", tt.name, s.Largest[0].Preview)
+		}
+		var histogram int64
+		for _, b := range s.Histogram {
+			histogram += b.Items
+		}
+		if histogram != 3 {
+			t.Errorf("%s: histogram counts %d items, want 3", tt.name, histogram)
+		}
+		if !tt.wantKey {
+			continue
+		}
+		if s.PartitionCount != 2 || len(s.HotPartitions) != 2 || s.HotPartitions[0].Value != "a" || s.HotPartitions[0].Items != 2 {
+			t.Errorf("%s: %d partitions, hot %v", tt.name, s.PartitionCount, s.HotPartitions)
+		}
+	}
+}
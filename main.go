@@ -12,6 +12,15 @@ func main() {
 	app.Commands = []cli.Command{
 		cmd.BuildArchive(),
 		cmd.BuildRestore(),
+		cmd.BuildVerify(),
+		cmd.BuildDiff(),
+		cmd.BuildCat(),
+		cmd.BuildStats(),
+		cmd.BuildSchema(),
+		cmd.BuildCopy(),
+		cmd.BuildUpdate(),
+		cmd.BuildDelete(),
+		cmd.BuildTruncate(),
 	}
 
 	app.Run(os.Args)
@@ -0,0 +1,51 @@
+package manifest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const groupSuffix = ".group.json"
+
+// Group links the archives of several tables taken together by one run, so they can be restored as a set
+type Group struct {
+	RunID       string       `json:"runId"`
+	Status      string       `json:"status"`
+	StartedAt   time.Time    `json:"startedAt"`
+	CompletedAt time.Time    `json:"completedAt"`
+	Tables      []GroupTable `json:"tables"`
+}
+
+// GroupTable is the archive of a table of the group
+type GroupTable struct {
+	Table    string `json:"table"`
+	Manifest string `json:"manifest"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GroupKey returns the key of the group manifest of the run, whose table archives are under baseKey/
+func GroupKey(baseKey string) string {
+	return baseKey + groupSuffix
+}
+
+// IsGroup reports whether the key is a group manifest
+func IsGroup(key string) bool {
+	return strings.HasSuffix(key, groupSuffix)
+}
+
+// WriteGroup uploads the group manifest to the bucket
+func WriteGroup(svc s3iface.S3API, bucket, key string, g *Group) error {
+	return writeJSON(svc, bucket, key, g)
+}
+
+// ReadGroup downloads the group manifest from the bucket
+func ReadGroup(svc s3iface.S3API, bucket, key string) (*Group, error) {
+	g := &Group{}
+	if err := readJSON(svc, bucket, key, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
@@ -0,0 +1,178 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const (
+	// KindFull is an archive of every item in the table
+	KindFull = "full"
+	// KindDeleted is an archive of the items a bulk delete removed, it is not a copy of the table
+	KindDeleted = "deleted"
+
+	// StatusComplete marks an archive which was uploaded successfully
+	StatusComplete = "complete"
+	// StatusFailed marks an archive which did not finish uploading
+	StatusFailed = "failed"
+
+	suffix = ".manifest.json"
+)
+
+// Manifest describes an archive of a table and the objects it is made of
+type Manifest struct {
+	Table       string    `json:"table"`
+	Kind        string    `json:"kind"`
+	Format      string    `json:"format"`
+	Status      string    `json:"status"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Parts       []Part    `json:"parts"`
+	// Segments is set for archives where every scan segment wrote its own parts
+	Segments       int   `json:"segments,omitempty"`
+	FailedSegments []int `json:"failedSegments,omitempty"`
+	// PartitionBy and Partitions are set for hive style partitioned archives
+	PartitionBy string      `json:"partitionBy,omitempty"`
+	Partitions  []Partition `json:"partitions,omitempty"`
+}
+
+// Part is a single object of an archive, which can be decoded on its own
+type Part struct {
+	Key    string `json:"key"`
+	Items  int64  `json:"items"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// Segment is the scan segment which wrote the part, for per segment archives
+	Segment *int `json:"segment,omitempty"`
+	// Partition is the hive style partition of the part, e.g. country=AU
+	Partition string `json:"partition,omitempty"`
+}
+
+// Partition is a hive style partition of an archive, its parts are under Prefix
+type Partition struct {
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+	Parts  int    `json:"parts"`
+	Items  int64  `json:"items"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Key returns the key of the manifest of the archive at baseKey, the archive key without an extension
+func Key(baseKey string) string {
+	return baseKey + suffix
+}
+
+// BaseKey returns the key of the archive the manifest belongs to, without an extension
+func BaseKey(manifestKey string) string {
+	return strings.TrimSuffix(manifestKey, suffix)
+}
+
+// IsManifest reports whether the key is a manifest rather than archive data
+func IsManifest(key string) bool {
+	return strings.HasSuffix(key, suffix)
+}
+
+// Write uploads the manifest to the bucket
+func Write(svc s3iface.S3API, bucket, key string, m *Manifest) error {
+	return writeJSON(svc, bucket, key, m)
+}
+
+func writeJSON(svc s3iface.S3API, bucket, key string, v interface{}) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = svc.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// Read downloads the manifest from the bucket
+func Read(svc s3iface.S3API, bucket, key string) (*Manifest, error) {
+	m := &Manifest{}
+	if err := readJSON(svc, bucket, key, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func readJSON(svc s3iface.S3API, bucket, key string, v interface{}) error {
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	if err := json.NewDecoder(out.Body).Decode(v); err != nil {
+		return fmt.Errorf("error %s whilst reading manifest %s", err, key)
+	}
+	return nil
+}
+
+// List reads every manifest of the table found under the prefix, oldest first
+func List(svc s3iface.S3API, bucket, prefix, table string) ([]*Manifest, error) {
+	input := &s3.ListObjectsInput{Bucket: aws.String(bucket)}
+	if prefix != "" {
+		input.Prefix = aws.String(strings.TrimSuffix(prefix, "/") + "/")
+	}
+
+	var keys []string
+	err := svc.ListObjectsPages(input, func(p *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, o := range p.Contents {
+			k := aws.StringValue(o.Key)
+			if strings.HasSuffix(k, "/"+table+suffix) || k == table+suffix {
+				keys = append(keys, k)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]*Manifest, 0, len(keys))
+	for _, k := range keys {
+		m, err := Read(svc, bucket, k)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Sort(byCompletedAt(manifests))
+	return manifests, nil
+}
+
+// AsOf picks the newest complete full archive which completed at or before t
+func AsOf(manifests []*Manifest, t time.Time) (*Manifest, error) {
+	var picked *Manifest
+	for _, m := range manifests {
+		if m.Kind == KindFull && m.Status == StatusComplete && !m.CompletedAt.After(t) {
+			picked = m
+		}
+	}
+	if picked == nil {
+		return nil, fmt.Errorf("no complete full archive found at or before %s", t.Format(time.RFC3339))
+	}
+	return picked, nil
+}
+
+type byCompletedAt []*Manifest
+
+func (m byCompletedAt) Len() int           { return len(m) }
+func (m byCompletedAt) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m byCompletedAt) Less(i, j int) bool { return m[i].CompletedAt.Before(m[j].CompletedAt) }
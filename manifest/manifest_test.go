@@ -0,0 +1,44 @@
+package manifest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsOf(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2016, 8, 1, hour, 0, 0, 0, time.UTC) }
+	manifests := []*Manifest{
+		{Kind: KindFull, Status: StatusComplete, CompletedAt: at(1)},
+		{Kind: KindFull, Status: StatusFailed, CompletedAt: at(2)},
+		{Kind: KindDeleted, Status: StatusComplete, CompletedAt: at(3)},
+		{Kind: KindFull, Status: StatusComplete, CompletedAt: at(4)},
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want int
+	}{
+		{"exact", at(1), 0},
+		{"skips failed", at(2), 0},
+		{"skips deleted", at(3), 0},
+		{"newest", at(5), 3},
+		{"none before", at(0), -1},
+	}
+	for _, tt := range tests {
+		got, err := AsOf(manifests, tt.t)
+		if tt.want == -1 {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != manifests[tt.want] {
+			t.Errorf("%s: picked %+v, want %+v", tt.name, got, manifests[tt.want])
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter keeps the capacity units consumed against a table under a rate per second. It is shared by every
+// segment or writer using the table, each of which waits for its turn after reporting what it consumed.
+type Limiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+// New creates a limiter for the units per second, a rate of 0 or less gives a nil limiter which never waits
+func New(perSecond float64) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &Limiter{rate: perSecond}
+}
+
+// Wait blocks until the units consumed by earlier calls have been spread out at the rate, then books the units
+// consumed by this call.
+func (l *Limiter) Wait(units float64) {
+	if l == nil || units <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(units / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
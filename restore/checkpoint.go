@@ -0,0 +1,185 @@
+package restore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+)
+
+// runCheckpoint records how far a restore run has got, for each archive file every item before its offset has
+// been written.
+type runCheckpoint struct {
+	RunID  string   `json:"runId"`
+	Table  string   `json:"table"`
+	Bucket string   `json:"bucket"`
+	Files  []string `json:"files"`
+	Format string   `json:"format,omitempty"`
+	// Operation describes the options which change the items restored and how, a resumed run has to have the same
+	Operation string                   `json:"operation"`
+	Parts     map[string]*partProgress `json:"parts"`
+}
+
+type partProgress struct {
+	Offset int64 `json:"offset"`
+}
+
+// operation describes every option which changes the items a restore writes or what it does with them. The
+// transforms and keys files are described by their contents, which could change between runs under the same name.
+func operation(c *DynamoResotreConfig) (string, error) {
+	transforms, err := fileDigest(c.TransformFile)
+	if err != nil {
+		return "", err
+	}
+	keys, err := fileDigest(c.KeysFile)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("restore where %s select %s transform %s keys %s compare-keys %v on-conflict %s columns %s no-header %v",
+		c.Where, c.Select, transforms, keys, c.CompareKeys, c.OnConflict, c.Columns, c.NoHeader), nil
+}
+
+// fileDigest is the sha256 of the file, or empty when no file is given
+func fileDigest(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkResume reports whether the checkpoint is of a restore of the same table with the same operation
+func checkResume(cp *runCheckpoint, table, operation string) error {
+	if cp.Table != table {
+		return fmt.Errorf("run %s restored to table %s, not %s", cp.RunID, cp.Table, table)
+	}
+	if cp.Operation != operation {
+		return fmt.Errorf("run %s did %q, not %q", cp.RunID, cp.Operation, operation)
+	}
+	return nil
+}
+
+func loadCheckpoint(runID string) (*runCheckpoint, error) {
+	cp := &runCheckpoint{}
+	if err := checkpoint.Load("restore", runID, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// checkpointer tracks the items in flight across the writers and moves the offset of each file forward to the
+// end of the last decoded chunk for which it and every chunk before it have been completely written.
+type checkpointer struct {
+	mu       sync.Mutex
+	cp       runCheckpoint
+	files    map[string]*fileTracker
+	lastSave time.Time
+	// disabled keeps the progress in memory only, for dry runs which have nothing to resume
+	disabled bool
+}
+
+type fileTracker struct {
+	progress *partProgress
+	chunks   map[int64]*chunk
+	next     int64
+	low      int64
+}
+
+type chunk struct {
+	pending int
+	end     int64
+}
+
+// newCheckpointer tracks the progress of the run, when disabled it never writes or removes the checkpoint file
+func newCheckpointer(cp *runCheckpoint, disabled bool) *checkpointer {
+	c := &checkpointer{cp: *cp, files: map[string]*fileTracker{}, disabled: disabled}
+	if c.cp.Parts == nil {
+		c.cp.Parts = map[string]*partProgress{}
+	}
+	return c
+}
+
+// startFile returns the offset to continue the file from
+func (c *checkpointer) startFile(key string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.cp.Parts[key]
+	if !ok {
+		p = &partProgress{}
+		c.cp.Parts[key] = p
+	}
+	c.files[key] = &fileTracker{progress: p, chunks: map[int64]*chunk{}}
+	return p.Offset
+}
+
+// add registers a decoded chunk of n items of the file ending at offset end, and returns the func to call as each
+// item is done
+func (c *checkpointer) add(key string, n int, end int64) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := c.files[key]
+	seq := f.next
+	f.next++
+	f.chunks[seq] = &chunk{pending: n, end: end}
+	if n == 0 {
+		c.advance(f)
+	}
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		f.chunks[seq].pending--
+		if seq == f.low {
+			c.advance(f)
+		}
+	}
+}
+
+func (c *checkpointer) advance(f *fileTracker) {
+	for {
+		ch, ok := f.chunks[f.low]
+		if !ok || ch.pending != 0 {
+			break
+		}
+		f.progress.Offset = ch.end
+		delete(f.chunks, f.low)
+		f.low++
+	}
+	if time.Since(c.lastSave) > checkpoint.Interval {
+		c.save()
+	}
+}
+
+// flush saves the checkpoint as it stands
+func (c *checkpointer) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.save()
+}
+
+// remove deletes the checkpoint once the run has completed
+func (c *checkpointer) remove() {
+	if c.disabled {
+		return
+	}
+	checkpoint.Remove("restore", c.cp.RunID)
+}
+
+func (c *checkpointer) save() {
+	c.lastSave = time.Now()
+	if c.disabled {
+		return
+	}
+	if err := checkpoint.Save("restore", c.cp.RunID, &c.cp); err != nil {
+		log.Printf("error %s whilst saving checkpoint", err)
+	}
+}
@@ -0,0 +1,150 @@
+package restore
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+)
+
+// inTempDir runs the test in a temporary directory, as the checkpoints are written to the working directory
+func inTempDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dynamotools-restore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+}
+
+func TestCheckpointerDisabled(t *testing.T) {
+	inTempDir(t)
+	c := newCheckpointer(&runCheckpoint{RunID: "dry", Files: []string{"a"}}, true)
+	c.startFile("a")
+	c.add("a", 0, 10)
+	c.flush()
+	if _, err := os.Stat(checkpoint.File("restore", "dry")); !os.IsNotExist(err) {
+		t.Errorf("a disabled checkpointer wrote %s", checkpoint.File("restore", "dry"))
+	}
+
+	// a dry run resuming a real run must leave its checkpoint in place
+	if err := ioutil.WriteFile(checkpoint.File("restore", "dry"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.remove()
+	if _, err := os.Stat(checkpoint.File("restore", "dry")); err != nil {
+		t.Errorf("a disabled checkpointer removed %s: %s", checkpoint.File("restore", "dry"), err)
+	}
+}
+
+func TestCheckpointerOffsets(t *testing.T) {
+	inTempDir(t)
+	tests := []struct {
+		name string
+		// chunks are the items and end offset of each decoded chunk
+		chunks [][2]int64
+		// done is the order the items are written in, as the chunk of each
+		done []int
+		want int64
+	}{
+		{"nothing written", [][2]int64{{2, 10}, {1, 20}}, nil, 0},
+		{"in order", [][2]int64{{2, 10}, {1, 20}}, []int{0, 0, 1}, 20},
+		{"first chunk partly written", [][2]int64{{2, 10}, {1, 20}}, []int{0, 1}, 0},
+		{"later chunk first", [][2]int64{{1, 10}, {1, 20}, {1, 30}}, []int{2, 0}, 10},
+		{"out of order", [][2]int64{{1, 10}, {1, 20}, {1, 30}}, []int{2, 1, 0}, 30},
+		{"empty chunk", [][2]int64{{1, 10}, {0, 20}, {1, 30}}, []int{0}, 20},
+	}
+	for _, tt := range tests {
+		c := newCheckpointer(&runCheckpoint{RunID: "offsets", Files: []string{"a"}}, false)
+		if offset := c.startFile("a"); offset != 0 {
+			t.Fatalf("%s: new file starts at %d", tt.name, offset)
+		}
+		var done [][]func()
+		for _, ch := range tt.chunks {
+			f := c.add("a", int(ch[0]), ch[1])
+			var items []func()
+			for i := int64(0); i < ch[0]; i++ {
+				items = append(items, f)
+			}
+			done = append(done, items)
+		}
+		for _, i := range tt.done {
+			done[i][0]()
+			done[i] = done[i][1:]
+		}
+		c.flush()
+
+		cp, err := loadCheckpoint("offsets")
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got := cp.Parts["a"].Offset; got != tt.want {
+			t.Errorf("%s: offset %d, want %d", tt.name, got, tt.want)
+		}
+		if offset := newCheckpointer(cp, false).startFile("a"); offset != tt.want {
+			t.Errorf("%s: resumed at %d, want %d", tt.name, offset, tt.want)
+		}
+	}
+}
+
+func TestCheckResume(t *testing.T) {
+	inTempDir(t)
+	if err := ioutil.WriteFile("transforms.json", []byte(`[{"op": "drop", "attributes": ["a"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base := DynamoResotreConfig{TableName: "jobs", Where: "a == 'x'", TransformFile: "transforms.json"}
+	op, err := operation(&base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &runCheckpoint{RunID: "run", Table: "jobs", Operation: op}
+	if err := checkResume(cp, "jobs", op); err != nil {
+		t.Errorf("the same restore can not resume: %s", err)
+	}
+	if err := checkResume(cp, "ads", op); err == nil {
+		t.Errorf("resumed into another table")
+	}
+
+	changed := []func(c *DynamoResotreConfig){
+		func(c *DynamoResotreConfig) { c.Where = "a == 'y'" },
+		func(c *DynamoResotreConfig) { c.Select = "{a: a}" },
+		func(c *DynamoResotreConfig) { c.OnConflict = "skip" },
+		func(c *DynamoResotreConfig) { c.CompareKeys = true },
+		func(c *DynamoResotreConfig) { c.Columns = "id:S" },
+		func(c *DynamoResotreConfig) { c.NoHeader = true },
+		func(c *DynamoResotreConfig) { c.TransformFile = "" },
+	}
+	for i, change := range changed {
+		c := base
+		change(&c)
+		other, err := operation(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkResume(cp, "jobs", other); err == nil {
+			t.Errorf("change %d: resumed with %q", i, other)
+		}
+	}
+
+	// the same file name with different transforms is a different restore
+	if err := ioutil.WriteFile("transforms.json", []byte(`[{"op": "drop", "attributes": ["b"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, err := operation(&base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkResume(cp, "jobs", other); err == nil {
+		t.Errorf("resumed after the transforms file changed")
+	}
+}
@@ -0,0 +1,129 @@
+package restore
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	// ConflictOverwrite blindly puts every item, replacing whatever is in the table
+	ConflictOverwrite = "overwrite"
+	// ConflictSkip only puts items which do not already exist in the table
+	ConflictSkip = "skip"
+	// ConflictNewerWins only puts items whose version attribute is newer than the one in the table
+	ConflictNewerWins = "newer-wins"
+
+	conditionalCheckFailed = "ConditionalCheckFailedException"
+)
+
+// ConflictPolicy describes what restore does when an item already exists in the table
+type ConflictPolicy struct {
+	Mode             string
+	VersionAttribute string
+}
+
+// ParseConflictPolicy parses the value of the on-conflict option (skip|overwrite|newer-wins:<attr>)
+func ParseConflictPolicy(s string) (*ConflictPolicy, error) {
+	switch {
+	case s == "" || s == ConflictOverwrite:
+		return &ConflictPolicy{Mode: ConflictOverwrite}, nil
+	case s == ConflictSkip:
+		return &ConflictPolicy{Mode: ConflictSkip}, nil
+	case strings.HasPrefix(s, ConflictNewerWins+":"):
+		attr := strings.TrimPrefix(s, ConflictNewerWins+":")
+		if attr == "" {
+			return nil, fmt.Errorf("missing version attribute in on-conflict value %q", s)
+		}
+		return &ConflictPolicy{Mode: ConflictNewerWins, VersionAttribute: attr}, nil
+	}
+	return nil, fmt.Errorf("invalid on-conflict value %q (skip|overwrite|newer-wins:<attr>)", s)
+}
+
+// Conditional reports whether the policy needs conditional puts instead of batch writes
+func (p *ConflictPolicy) Conditional() bool {
+	return p.Mode != ConflictOverwrite
+}
+
+// WriteStats counts the items written and skipped by the dynamo writers
+type WriteStats struct {
+	Written int64
+	Skipped int64
+}
+
+func (s *WriteStats) written() { atomic.AddInt64(&s.Written, 1) }
+func (s *WriteStats) skipped() { atomic.AddInt64(&s.Skipped, 1) }
+
+type conditionalWriter struct {
+	db      dynamodbiface.DynamoDBAPI
+	table   string
+	hashKey string
+	policy  *ConflictPolicy
+	stats   *WriteStats
+}
+
+// NewDynamoConditionalWriter creates new dynamo writer which puts items one at a time with a condition
+// derived from the conflict policy. hashKey is only required for the skip policy.
+func NewDynamoConditionalWriter(db dynamodbiface.DynamoDBAPI, table, hashKey string, policy *ConflictPolicy, stats *WriteStats) DynamoWriter {
+	return &conditionalWriter{
+		db:      db,
+		table:   table,
+		hashKey: hashKey,
+		policy:  policy,
+		stats:   stats,
+	}
+}
+
+func (cw *conditionalWriter) Write(input chan *Item) error {
+	for obj := range input {
+		av, err := dynamodbattribute.MarshalMap(obj.Attributes)
+		if err != nil {
+			log.Printf("error convernting to *dynamodb.AttributeValue: %v", err)
+			obj.Done()
+			continue
+		}
+
+		_, err = cw.db.PutItem(cw.buildPutInput(av))
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == conditionalCheckFailed {
+			cw.stats.skipped()
+			obj.Done()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		cw.stats.written()
+		obj.Done()
+	}
+	return nil
+}
+
+func (cw *conditionalWriter) buildPutInput(av map[string]*dynamodb.AttributeValue) *dynamodb.PutItemInput {
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(cw.table),
+		Item:      av,
+	}
+
+	switch cw.policy.Mode {
+	case ConflictSkip:
+		input.ConditionExpression = aws.String("attribute_not_exists(#key)")
+		input.ExpressionAttributeNames = map[string]*string{"#key": aws.String(cw.hashKey)}
+	case ConflictNewerWins:
+		input.ExpressionAttributeNames = map[string]*string{"#ver": aws.String(cw.policy.VersionAttribute)}
+		if v, ok := av[cw.policy.VersionAttribute]; ok {
+			input.ConditionExpression = aws.String("attribute_not_exists(#ver) OR #ver < :ver")
+			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{":ver": v}
+		} else {
+			// without a version the archived item can only win against an unversioned one.
+			input.ConditionExpression = aws.String("attribute_not_exists(#ver)")
+		}
+	}
+	return input
+}
@@ -0,0 +1,206 @@
+package restore
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// fakeTable is a table keyed by the string attribute id, which checks the conditions the restore writers use
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+	err   error
+}
+
+func newFakeTable(t *testing.T, items ...map[string]interface{}) *fakeTable {
+	ft := &fakeTable{items: map[string]map[string]*dynamodb.AttributeValue{}}
+	for _, item := range items {
+		av, err := dynamodbattribute.MarshalMap(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ft.items[aws.StringValue(av["id"].S)] = av
+	}
+	return ft
+}
+
+func (ft *fakeTable) PutItem(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if ft.err != nil {
+		return nil, ft.err
+	}
+	id := aws.StringValue(in.Item["id"].S)
+	live, exists := ft.items[id]
+	var liveVersion *dynamodb.AttributeValue
+	if exists && in.ExpressionAttributeNames["#ver"] != nil {
+		liveVersion = live[aws.StringValue(in.ExpressionAttributeNames["#ver"])]
+	}
+	ok := true
+	switch aws.StringValue(in.ConditionExpression) {
+	case "":
+	case "attribute_not_exists(#key)":
+		ok = !exists
+	case "attribute_not_exists(#ver)":
+		ok = liveVersion == nil
+	case "attribute_not_exists(#ver) OR #ver < :ver":
+		ok = liveVersion == nil || number(liveVersion) < number(in.ExpressionAttributeValues[":ver"])
+	default:
+		return nil, errors.New("unexpected condition " + aws.StringValue(in.ConditionExpression))
+	}
+	if !ok {
+		return nil, awserr.New(conditionalCheckFailed, "the conditional request failed", nil)
+	}
+	ft.items[id] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (ft *fakeTable) BatchGetItem(in *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if ft.err != nil {
+		return nil, ft.err
+	}
+	out := &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{}}
+	for table, ka := range in.RequestItems {
+		for _, key := range ka.Keys {
+			if item, ok := ft.items[aws.StringValue(key["id"].S)]; ok {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+	}
+	return out, nil
+}
+
+// get returns the item with the id as it is in the table
+func (ft *fakeTable) get(t *testing.T, id string) map[string]interface{} {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	av, ok := ft.items[id]
+	if !ok {
+		return nil
+	}
+	var item map[string]interface{}
+	if err := dynamodbattribute.UnmarshalMap(av, &item); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func number(av *dynamodb.AttributeValue) float64 {
+	n, _ := strconv.ParseFloat(aws.StringValue(av.N), 64)
+	return n
+}
+
+// writeItems sends the items through the writer and returns how many were done
+func writeItems(w DynamoWriter, items ...map[string]interface{}) (int, error) {
+	var mu sync.Mutex
+	var done int
+	in := make(chan *Item, len(items))
+	for _, item := range items {
+		in <- &Item{Attributes: item, Done: func() { mu.Lock(); done++; mu.Unlock() }}
+	}
+	close(in)
+	err := w.Write(in)
+	return done, err
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		value       string
+		want        ConflictPolicy
+		conditional bool
+		wantErr     bool
+	}{
+		{"", ConflictPolicy{Mode: ConflictOverwrite}, false, false},
+		{"overwrite", ConflictPolicy{Mode: ConflictOverwrite}, false, false},
+		{"skip", ConflictPolicy{Mode: ConflictSkip}, true, false},
+		{"newer-wins:version", ConflictPolicy{Mode: ConflictNewerWins, VersionAttribute: "version"}, true, false},
+		{"newer-wins:", ConflictPolicy{}, false, true},
+		{"fail", ConflictPolicy{}, false, true},
+	}
+	for _, tt := range tests {
+		p, err := ParseConflictPolicy(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if *p != tt.want || p.Conditional() != tt.conditional {
+			t.Errorf("%q: policy %+v conditional %v, want %+v %v", tt.value, *p, p.Conditional(), tt.want, tt.conditional)
+		}
+	}
+}
+
+func TestConditionalWriter(t *testing.T) {
+	live := []map[string]interface{}{
+		{"id": "old", "version": 2.0, "v": "live"},
+		{"id": "new", "version": 2.0, "v": "live"},
+		{"id": "unversioned", "v": "live"},
+		{"id": "versioned", "version": 1.0, "v": "live"},
+	}
+	archived := []map[string]interface{}{
+		{"id": "old", "version": 1.0, "v": "archived"},
+		{"id": "new", "version": 3.0, "v": "archived"},
+		{"id": "unversioned", "v": "archived"},
+		{"id": "absent", "version": 1.0, "v": "archived"},
+		{"id": "versioned", "v": "archived"},
+	}
+	tests := []struct {
+		policy string
+		// want is the value of v each item ends up with
+		want    map[string]string
+		written int64
+		skipped int64
+	}{
+		{"skip", map[string]string{"old": "live", "new": "live", "unversioned": "live", "absent": "archived", "versioned": "live"}, 1, 4},
+		{"newer-wins:version", map[string]string{"old": "live", "new": "archived", "unversioned": "archived", "absent": "archived", "versioned": "live"}, 3, 2},
+	}
+	for _, tt := range tests {
+		policy, err := ParseConflictPolicy(tt.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := newFakeTable(t, live...)
+		stats := &WriteStats{}
+		done, err := writeItems(NewDynamoConditionalWriter(db, "jobs", "id", policy, stats), archived...)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.policy, err)
+		}
+		if done != len(archived) {
+			t.Errorf("%s: %d items done, want %d", tt.policy, done, len(archived))
+		}
+		for id, v := range tt.want {
+			if got := db.get(t, id)["v"]; got != v {
+				t.Errorf("%s: %s is %v, want %s", tt.policy, id, got, v)
+			}
+		}
+		if stats.Written != tt.written || stats.Skipped != tt.skipped {
+			t.Errorf("%s: %d written %d skipped, want %d and %d", tt.policy, stats.Written, stats.Skipped, tt.written, tt.skipped)
+		}
+	}
+}
+
+func TestConditionalWriterFails(t *testing.T) {
+	policy, _ := ParseConflictPolicy("skip")
+	db := newFakeTable(t)
+	db.err = awserr.New("ProvisionedThroughputExceededException", "slow down", nil)
+	done, err := writeItems(NewDynamoConditionalWriter(db, "jobs", "id", policy, &WriteStats{}), map[string]interface{}{"id": "a"})
+	if err == nil {
+		t.Errorf("an error other than a failed condition did not stop the writer")
+	}
+	if done != 0 {
+		t.Errorf("%d items done after the put failed", done)
+	}
+}
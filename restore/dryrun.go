@@ -0,0 +1,205 @@
+package restore
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	maxItemSize   = 400 * 1024
+	writeUnitSize = 1024
+)
+
+// categoryCounts counts the items which could not be restored by the reason why
+type categoryCounts struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newCategoryCounts() *categoryCounts {
+	return &categoryCounts{counts: map[string]int64{}}
+}
+
+func (c *categoryCounts) add(category string) {
+	c.mu.Lock()
+	c.counts[category]++
+	c.mu.Unlock()
+}
+
+func (c *categoryCounts) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.counts) == 0 {
+		return "none"
+	}
+	var parts []string
+	for k, v := range c.counts {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, v))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// dryRunStats sums up what a dry run would have written
+type dryRunStats struct {
+	mu       sync.Mutex
+	items    int64
+	bytes    int64
+	wcu      int64
+	largest  int64
+	failures *categoryCounts
+}
+
+func (s *dryRunStats) add(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items++
+	s.bytes += size
+	s.wcu += (size + writeUnitSize - 1) / writeUnitSize
+	if size > s.largest {
+		s.largest = size
+	}
+}
+
+func (s *dryRunStats) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d valid items, %d bytes, largest item %d bytes, estimated %d WCU, errors: %s",
+		s.items, s.bytes, s.largest, s.wcu, s.failures)
+}
+
+type dryRunWriter struct {
+	keyTypes map[string]string
+	stats    *dryRunStats
+}
+
+// newDryRunWriter creates a dynamo writer which marshals and validates the items without writing them
+func newDryRunWriter(keyTypes map[string]string, stats *dryRunStats) DynamoWriter {
+	return &dryRunWriter{keyTypes: keyTypes, stats: stats}
+}
+
+func (dw *dryRunWriter) Write(input chan *Item) error {
+	for obj := range input {
+		if category := dw.validate(obj.Attributes); category != "" {
+			dw.stats.failures.add(category)
+		}
+		obj.Done()
+	}
+	return nil
+}
+
+func (dw *dryRunWriter) validate(item map[string]interface{}) string {
+	req, err := newPutRequest(item)
+	if err != nil {
+		return "marshal"
+	}
+	av := req.PutRequest.Item
+
+	for name, typ := range dw.keyTypes {
+		v, ok := av[name]
+		if !ok {
+			return "missing key"
+		}
+		if attributeType(v) != typ {
+			return "key type"
+		}
+	}
+
+	size := itemSize(av)
+	if size > maxItemSize {
+		return "over 400KB"
+	}
+	dw.stats.add(size)
+	return ""
+}
+
+func attributeType(v *dynamodb.AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return dynamodb.ScalarAttributeTypeS
+	case v.N != nil:
+		return dynamodb.ScalarAttributeTypeN
+	case v.B != nil:
+		return dynamodb.ScalarAttributeTypeB
+	case v.BOOL != nil:
+		return "BOOL"
+	case v.NULL != nil:
+		return "NULL"
+	case v.M != nil:
+		return "M"
+	case v.L != nil:
+		return "L"
+	case v.SS != nil:
+		return "SS"
+	case v.NS != nil:
+		return "NS"
+	case v.BS != nil:
+		return "BS"
+	}
+	return ""
+}
+
+// itemSize follows the dynamo rules for calculating item sizes, the sum of the attribute names and values
+func itemSize(item map[string]*dynamodb.AttributeValue) int64 {
+	var size int64
+	for name, v := range item {
+		size += int64(len(name)) + valueSize(v)
+	}
+	return size
+}
+
+func valueSize(v *dynamodb.AttributeValue) int64 {
+	switch {
+	case v.S != nil:
+		return int64(len(*v.S))
+	case v.N != nil:
+		return numberSize(*v.N)
+	case v.B != nil:
+		return int64(len(v.B))
+	case v.BOOL != nil, v.NULL != nil:
+		return 1
+	case v.M != nil:
+		return 3 + itemSize(v.M)
+	case v.L != nil:
+		size := int64(3)
+		for _, e := range v.L {
+			size += 1 + valueSize(e)
+		}
+		return size
+	case v.SS != nil:
+		var size int64
+		for _, s := range v.SS {
+			size += int64(len(*s))
+		}
+		return size
+	case v.NS != nil:
+		var size int64
+		for _, n := range v.NS {
+			size += numberSize(*n)
+		}
+		return size
+	case v.BS != nil:
+		var size int64
+		for _, b := range v.BS {
+			size += int64(len(b))
+		}
+		return size
+	}
+	return 0
+}
+
+// numberSize is roughly one byte per two significant digits plus one
+func numberSize(n string) int64 {
+	digits := strings.Trim(strings.TrimLeft(n, "-+"), "0.")
+	digits = strings.Replace(digits, ".", "", -1)
+	return int64((len(digits)+1)/2 + 1)
+}
+
+func logDryRun(table string, stats *dryRunStats) {
+	log.Printf("dry run of restoring to %s: %s", table, stats.summary())
+}
@@ -0,0 +1,67 @@
+package restore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestItemSize(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]*dynamodb.AttributeValue
+		want int64
+	}{
+		{"string", map[string]*dynamodb.AttributeValue{"id": {S: aws.String("abc")}}, 5},
+		{"number", map[string]*dynamodb.AttributeValue{"n": {N: aws.String("123.45")}}, 5},
+		{"small number", map[string]*dynamodb.AttributeValue{"n": {N: aws.String("-0.001")}}, 3},
+		{"bool", map[string]*dynamodb.AttributeValue{"ok": {BOOL: aws.Bool(true)}}, 3},
+		{"map", map[string]*dynamodb.AttributeValue{"m": {M: map[string]*dynamodb.AttributeValue{"a": {S: aws.String("b")}}}}, 6},
+		{"list", map[string]*dynamodb.AttributeValue{"l": {L: []*dynamodb.AttributeValue{{S: aws.String("x")}, {N: aws.String("1")}}}}, 9},
+		{"string set", map[string]*dynamodb.AttributeValue{"ss": {SS: aws.StringSlice([]string{"ab", "c"})}}, 5},
+		{"binary", map[string]*dynamodb.AttributeValue{"b": {B: []byte{1, 2, 3, 4}}}, 5},
+		{"several", map[string]*dynamodb.AttributeValue{"id": {S: aws.String("abc")}, "ok": {NULL: aws.Bool(true)}}, 8},
+	}
+	for _, tt := range tests {
+		if got := itemSize(tt.item); got != tt.want {
+			t.Errorf("%s: size %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDryRunValidate(t *testing.T) {
+	keyTypes := map[string]string{"id": dynamodb.ScalarAttributeTypeS}
+	tests := []struct {
+		name string
+		item map[string]interface{}
+		want string
+	}{
+		{"valid", map[string]interface{}{"id": "a", "n": 1.5}, ""},
+		{"missing key", map[string]interface{}{"n": 1.5}, "missing key"},
+		{"key type", map[string]interface{}{"id": 1.0}, "key type"},
+		{"too large", map[string]interface{}{"id": "a", "body": strings.Repeat("x", maxItemSize)}, "over 400KB"},
+	}
+	for _, tt := range tests {
+		stats := &dryRunStats{failures: newCategoryCounts()}
+		dw := newDryRunWriter(keyTypes, stats).(*dryRunWriter)
+		if got := dw.validate(tt.item); got != tt.want {
+			t.Errorf("%s: category %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDryRunStats(t *testing.T) {
+	stats := &dryRunStats{failures: newCategoryCounts()}
+	for _, size := range []int64{1, 1024, 1025, 3000} {
+		stats.add(size)
+	}
+	if stats.items != 4 || stats.bytes != 5050 || stats.largest != 3000 {
+		t.Errorf("got %d items, %d bytes, largest %d", stats.items, stats.bytes, stats.largest)
+	}
+	// 1 + 1 + 2 + 3 write units
+	if stats.wcu != 7 {
+		t.Errorf("estimated %d WCU, want 7", stats.wcu)
+	}
+}
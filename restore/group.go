@@ -0,0 +1,56 @@
+package restore
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// restoreGroup restores every table of the group manifest in turn, each from its own manifest, or only the table
+// given. A table which fails does not stop the others.
+func restoreGroup(c *DynamoResotreConfig) error {
+	if c.Resume != "" {
+		return fmt.Errorf("a group restore can not be resumed, resume the restore of the table which failed")
+	}
+	if c.KeysFile != "" && c.TableName == "" {
+		return fmt.Errorf("restoring keys from a group needs the table they belong to")
+	}
+	g, err := manifest.ReadGroup(s3.New(awssession.New(c.Region)), c.Bucket, c.Manifest)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	found := false
+	for _, gt := range g.Tables {
+		if c.TableName != "" && gt.Table != c.TableName {
+			continue
+		}
+		found = true
+		if gt.Status != manifest.StatusComplete {
+			log.Printf("skipping %s, its archive in run %s is %s", gt.Table, g.RunID, gt.Status)
+			failed = append(failed, gt.Table)
+			continue
+		}
+		tc := *c
+		tc.TableName = gt.Table
+		tc.Manifest = gt.Manifest
+		log.Printf("restoring %s from %s", gt.Table, gt.Manifest)
+		if err := ToDyanmo(&tc); err != nil {
+			log.Printf("error %s whilst restoring %s", err, gt.Table)
+			failed = append(failed, gt.Table)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s is not in the group %s", c.TableName, c.Manifest)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("%d tables of the group were not restored: %s", len(failed), strings.Join(failed, ", "))
+	}
+	log.Printf("restored the tables of group %s", g.RunID)
+	return nil
+}
@@ -0,0 +1,307 @@
+package restore
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// keySet holds the primary keys read from a keys file and tracks which of them were found in the archive
+type keySet struct {
+	attrs []string
+	keys  map[string]map[string]interface{}
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// loadKeys reads the primary keys for attrs from a csv file with a header row or from a file of json lines
+func loadKeys(path string, attrs []string) (*keySet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ks := &keySet{attrs: attrs, keys: map[string]map[string]interface{}{}, seen: map[string]bool{}}
+	r := bufio.NewReader(f)
+	first, err := r.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(first) == 1 && first[0] == '{' {
+		err = ks.readJSON(r)
+	} else {
+		err = ks.readCSV(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error %s whilst reading keys from %s", err, path)
+	}
+
+	log.Printf("loaded %d keys from %s", len(ks.keys), path)
+	return ks, nil
+}
+
+// LoadKeys reads the distinct primary keys for attrs from a csv file with a header row or from a file of json
+// lines. Values read from csv are strings whatever the type of the key attribute, json numbers keep their digits
+// as a dynamodbattribute.Number.
+func LoadKeys(path string, attrs []string) ([]map[string]interface{}, error) {
+	ks, err := loadKeys(path, attrs)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]map[string]interface{}, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, table.Key(key, attrs))
+	}
+	return keys, nil
+}
+
+func (ks *keySet) readJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	// numbers are kept as written, a float64 would round keys of more than 15 digits.
+	dec.UseNumber()
+	for {
+		var key map[string]interface{}
+		if err := dec.Decode(&key); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for a, v := range key {
+			if n, ok := v.(json.Number); ok {
+				key[a] = dynamodbattribute.Number(n)
+			}
+		}
+		if err := ks.add(key); err != nil {
+			return err
+		}
+	}
+}
+
+func (ks *keySet) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		key := map[string]interface{}{}
+		for i, col := range header {
+			key[strings.TrimSpace(col)] = row[i]
+		}
+		if err := ks.add(key); err != nil {
+			return err
+		}
+	}
+}
+
+func (ks *keySet) add(key map[string]interface{}) error {
+	id, ok := ks.id(key)
+	if !ok {
+		return fmt.Errorf("key %v does not have all of the key attributes %v", key, ks.attrs)
+	}
+	ks.keys[id] = key
+	return nil
+}
+
+func (ks *keySet) id(item map[string]interface{}) (string, bool) {
+	return table.KeyID(item, ks.attrs)
+}
+
+// match reports whether the item's key is in the set, and marks it as seen
+func (ks *keySet) match(item map[string]interface{}) bool {
+	id, ok := ks.id(item)
+	if !ok {
+		return false
+	}
+	if _, ok := ks.keys[id]; !ok {
+		return false
+	}
+	ks.mu.Lock()
+	ks.seen[id] = true
+	ks.mu.Unlock()
+	return true
+}
+
+// unseen returns the keys which did not match any item
+func (ks *keySet) unseen() []map[string]interface{} {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	var keys []map[string]interface{}
+	for id, key := range ks.keys {
+		if !ks.seen[id] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keyReport writes the outcome of comparing archived items with the live table as json lines
+type keyReport struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	counts  map[string]int
+	keyAttr []string
+}
+
+const (
+	keySame         = "same"
+	keyMissing      = "missing"
+	keyDifferent    = "different"
+	keyNotInArchive = "not-in-archive"
+)
+
+func newKeyReport(w io.Writer, keyAttrs []string) *keyReport {
+	return &keyReport{enc: json.NewEncoder(w), counts: map[string]int{}, keyAttr: keyAttrs}
+}
+
+func (r *keyReport) add(status string, item map[string]interface{}) error {
+	key := map[string]interface{}{}
+	for _, a := range r.keyAttr {
+		key[a] = item[a]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[status]++
+	if status == keySame {
+		return nil
+	}
+	return r.enc.Encode(map[string]interface{}{"status": status, "key": key})
+}
+
+func (r *keyReport) summary() string {
+	return fmt.Sprintf("%d same, %d missing, %d different, %d not in archive",
+		r.counts[keySame], r.counts[keyMissing], r.counts[keyDifferent], r.counts[keyNotInArchive])
+}
+
+type keyComparer struct {
+	db       dynamodbiface.DynamoDBAPI
+	table    string
+	keyAttrs []string
+	report   *keyReport
+}
+
+// newDynamoKeyComparer creates a dynamo writer which does not write anything, instead it fetches the
+// live version of every item with BatchGetItem and reports the ones which are missing or different.
+func newDynamoKeyComparer(db dynamodbiface.DynamoDBAPI, table string, keyAttrs []string, report *keyReport) DynamoWriter {
+	return &keyComparer{db: db, table: table, keyAttrs: keyAttrs, report: report}
+}
+
+func (kc *keyComparer) Write(input chan *Item) error {
+	const batchSize = 100 // BatchGetItem limit
+	var batch []*Item
+	for obj := range input {
+		batch = append(batch, obj)
+		if len(batch) == batchSize {
+			if err := kc.compare(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if len(batch) != 0 {
+		return kc.compare(batch)
+	}
+	return nil
+}
+
+func (kc *keyComparer) compare(batch []*Item) error {
+	ks := &keySet{attrs: kc.keyAttrs}
+	archived := map[string]map[string]interface{}{}
+	var keys []map[string]*dynamodb.AttributeValue
+	for _, item := range batch {
+		av, err := dynamodbattribute.MarshalMap(item.Attributes)
+		if err != nil {
+			log.Printf("error convernting to *dynamodb.AttributeValue: %v", err)
+			continue
+		}
+		// round trip the item so it compares equal to the unmarshalled live item.
+		var normalised map[string]interface{}
+		if err := dynamodbattribute.UnmarshalMap(av, &normalised); err != nil {
+			return err
+		}
+		id, _ := ks.id(normalised)
+		if _, dup := archived[id]; dup {
+			continue
+		}
+		archived[id] = normalised
+
+		key := map[string]*dynamodb.AttributeValue{}
+		for _, a := range kc.keyAttrs {
+			key[a] = av[a]
+		}
+		keys = append(keys, key)
+	}
+
+	delay := 250 * time.Millisecond
+	for len(keys) != 0 {
+		resp, err := kc.db.BatchGetItem(&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				kc.table: {Keys: keys, ConsistentRead: aws.Bool(true)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, av := range resp.Responses[kc.table] {
+			var live map[string]interface{}
+			if err := dynamodbattribute.UnmarshalMap(av, &live); err != nil {
+				return err
+			}
+			id, _ := ks.id(live)
+			item, ok := archived[id]
+			if !ok {
+				continue
+			}
+			delete(archived, id)
+			status := keySame
+			if !reflect.DeepEqual(item, live) {
+				status = keyDifferent
+			}
+			if err := kc.report.add(status, item); err != nil {
+				return err
+			}
+		}
+
+		keys = nil
+		if unprocessed, ok := resp.UnprocessedKeys[kc.table]; ok && len(unprocessed.Keys) != 0 {
+			log.Printf("retrying unprocessed keys after %v", delay)
+			time.Sleep(delay)
+			delay *= 2
+			keys = unprocessed.Keys
+		}
+	}
+
+	// whatever was not returned is not in the table.
+	for _, item := range archived {
+		if err := kc.report.add(keyMissing, item); err != nil {
+			return err
+		}
+	}
+	for _, item := range batch {
+		item.Done()
+	}
+	return nil
+}
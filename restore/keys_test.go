@@ -0,0 +1,114 @@
+package restore
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeKeys(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "dynamotools-keys-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"csv", "id, sort\na,1\nb,2\na,1\n", []string{"a/1", "b/2"}, false},
+		{"json lines", "{\"id\": \"a\", \"sort\": 1}\n{\"id\": \"b\", \"sort\": 2, \"other\": true}\n", []string{"a/1", "b/2"}, false},
+		{"csv missing attribute", "id\na\n", nil, true},
+		{"json missing attribute", "{\"id\": \"a\"}\n", nil, true},
+		{"invalid json", "{\"id\": \n", nil, true},
+	}
+	for _, tt := range tests {
+		keys, err := LoadKeys(writeKeys(t, tt.content), []string{"id", "sort"})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, key := range keys {
+			if len(key) != 2 {
+				t.Errorf("%s: key %v has attributes other than the key", tt.name, key)
+			}
+			got = append(got, fmt.Sprintf("%v/%v", key["id"], key["sort"]))
+		}
+		sort.Strings(got)
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: keys %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestKeySetMatch(t *testing.T) {
+	ks, err := loadKeys(writeKeys(t, "id\na\nb\nc\n"), []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "c", "d"} {
+		want := id != "d"
+		if got := ks.match(map[string]interface{}{"id": id, "other": 1.0}); got != want {
+			t.Errorf("match %s is %v, want %v", id, got, want)
+		}
+	}
+	if ks.match(map[string]interface{}{"other": 1.0}) {
+		t.Errorf("an item without the key matched")
+	}
+	unseen := ks.unseen()
+	if len(unseen) != 1 || unseen[0]["id"] != "b" {
+		t.Errorf("unseen %v, want b", unseen)
+	}
+}
+
+func TestKeyComparer(t *testing.T) {
+	db := newFakeTable(t,
+		map[string]interface{}{"id": "same", "v": 1.0},
+		map[string]interface{}{"id": "different", "v": 1.0},
+	)
+	var out bytes.Buffer
+	report := newKeyReport(&out, []string{"id"})
+	done, err := writeItems(newDynamoKeyComparer(db, "jobs", []string{"id"}, report),
+		map[string]interface{}{"id": "same", "v": 1.0},
+		map[string]interface{}{"id": "different", "v": 2.0},
+		map[string]interface{}{"id": "missing", "v": 1.0},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done != 3 {
+		t.Errorf("%d items done, want 3", done)
+	}
+	if got, want := report.summary(), "1 same, 1 missing, 1 different, 0 not in archive"; got != want {
+		t.Errorf("summary %q, want %q", got, want)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	want := []string{
+		`{"key":{"id":"different"},"status":"different"}`,
+		`{"key":{"id":"missing"},"status":"missing"}`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("reported\n%v\nwant\n%v", lines, want)
+	}
+	if db.get(t, "different")["v"] != 1.0 {
+		t.Errorf("comparing the keys wrote to the table")
+	}
+}
@@ -0,0 +1,157 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/transform"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/sync/errgroup"
+)
+
+// itemsBuffer is how many decoded items can wait for a writer, so the readers are not held up by a slow batch
+const itemsBuffer = 1000
+
+// restorer runs the items of archive files through the filters and transforms into the dynamo writers
+type restorer struct {
+	session     *session.Session
+	checkpoints *checkpointer
+	filter      *filter.Filter
+	transform   *transform.Transformer
+	keys        *keySet
+	failures    *categoryCounts
+	workers     int
+	readers     int
+	format      string
+	columns     *source.CSVMapping
+	newWriter   func() DynamoWriter
+}
+
+// restoreFiles reads the files in parallel, each with its own reader and decoder, into a shared set of writers
+func (r *restorer) restoreFiles(bucket string, files []string) error {
+	itemsChan := make(chan *Item, itemsBuffer)
+
+	log.Println("starting dynmo writer")
+	writers, ctx := errgroup.WithContext(context.Background())
+
+	log.Println("workers ", r.workers)
+	for index := 0; index < r.workers; index++ {
+		writers.Go(func() error {
+			return r.newWriter().Write(itemsChan)
+		})
+	}
+
+	readers, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, r.readers)
+	for index, key := range files {
+		index, key := index, key
+		readers.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+			return r.readFile(ctx, bucket, key, index, itemsChan)
+		})
+	}
+
+	rerr := readers.Wait()
+	close(itemsChan)
+	if err := writers.Wait(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// readFile downloads the file and sends its items to the writers, continuing from the checkpoint if there is one
+func (r *restorer) readFile(ctx context.Context, bucket, key string, index int, out chan *Item) error {
+	offset := r.checkpoints.startFile(key)
+
+	dl := s3manager.NewDownloader(r.session)
+
+	localFile := fmt.Sprintf("restore-file-%s-%d", time.Now().Format("2006-01-02"), index)
+	file, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	defer os.Remove(file.Name())
+
+	log.Printf("downloading restore file %s ....", key)
+	_, err = dl.Download(file, &s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	format := r.format
+	if format == source.FormatAuto && source.IsCSV(key) {
+		format = source.FormatCSV
+	}
+	dec, err := source.Open(file, format, offset, r.columns)
+	if err != nil {
+		return fmt.Errorf("error %s whilst opening %s", err, key)
+	}
+
+	for {
+		items, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("error %s whilst decoding %s", err, key)
+		}
+		var kept []map[string]interface{}
+		for _, item := range items {
+			if item, ok := r.process(item); ok {
+				kept = append(kept, item)
+			}
+		}
+		done := r.checkpoints.add(key, len(kept), dec.Offset())
+		for _, item := range kept {
+			select {
+			case out <- &Item{Attributes: item, Done: done}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	log.Printf("finished reading %s", key)
+	return nil
+}
+
+// process filters and transforms an item, it returns false for items which should not be restored
+func (r *restorer) process(item map[string]interface{}) (map[string]interface{}, bool) {
+	item, ok, err := r.filter.Apply(item)
+	if err != nil {
+		log.Printf("error %s whilst filtering item, skipping it", err)
+		r.failures.add("filter")
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	if item, err = r.transform.Apply(item); err != nil {
+		log.Printf("error %s whilst transforming item, skipping it", err)
+		r.failures.add("transform")
+		return nil, false
+	}
+	if r.keys != nil && !r.keys.match(item) {
+		return nil, false
+	}
+	return item, true
+}
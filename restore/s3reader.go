@@ -1,104 +1,186 @@
 package restore
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws/defaults"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/SEEK-Jobs/dynamotools/transform"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"golang.org/x/sync/errgroup"
 )
 
 // DynamoResotreConfig provides the configuration for archiving dynamo table to s3
 type DynamoResotreConfig struct {
-	Region      string
-	TableName   string
-	Workers     int
-	Bucket      string
-	RestoreFile string
+	Region         string
+	TableName      string
+	Workers        int
+	Bucket         string
+	RestoreFile    string
+	OnConflict     string
+	PutConcurrency int
+	TransformFile  string
+	Where          string
+	Select         string
+	KeysFile       string
+	CompareKeys    bool
+	AsOf           string
+	Prefix         string
+	Resume         string
+	DryRun         bool
+	Manifest       string
+	PartsPrefix    string
+	Readers        int
+	Export         string
+	Columns        string
+	NoHeader       bool
 }
 
 // ToDyanmo restores the data from the file in the s3 bucket to the specified dynamo table
 func ToDyanmo(c *DynamoResotreConfig) error {
-	s := getNewAwsSession(c.Region)
-	dl := s3manager.NewDownloader(s)
+	if manifest.IsGroup(c.Manifest) {
+		return restoreGroup(c)
+	}
+	policy, err := ParseConflictPolicy(c.OnConflict)
+	if err != nil {
+		return err
+	}
 
-	localFile := fmt.Sprintf("restore-file-%s", time.Now().Format("2006-01-02"))
-	file, err := os.Create(localFile)
+	var t *transform.Transformer
+	if c.TransformFile != "" {
+		if t, err = transform.Load(c.TransformFile); err != nil {
+			return err
+		}
+	}
+	f, err := filter.New(c.Where, c.Select)
+	if err != nil {
+		return err
+	}
+	columns, err := source.ParseCSVMapping(c.Columns, c.NoHeader)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
-	defer os.Remove(file.Name())
+	if c.CompareKeys && c.KeysFile == "" {
+		return fmt.Errorf("comparing keys needs a keys file")
+	}
+	if c.CompareKeys && c.DryRun {
+		return fmt.Errorf("comparing keys can not be combined with a dry run")
+	}
 
-	log.Println("downloading restore file ....")
-	_, err = dl.Download(file, &s3.GetObjectInput{
-		Bucket: &c.Bucket,
-		Key:    &c.RestoreFile,
-	})
+	s := awssession.New(c.Region)
 
+	op, err := operation(c)
 	if err != nil {
 		return err
 	}
+	var cp *runCheckpoint
+	if c.Resume != "" {
+		if cp, err = loadCheckpoint(c.Resume); err != nil {
+			return err
+		}
+		if err := checkResume(cp, c.TableName, op); err != nil {
+			return err
+		}
+		log.Printf("resuming run %s", cp.RunID)
+	} else {
+		files, format, err := selectFiles(s3.New(s), c)
+		if err != nil {
+			return err
+		}
+		cp = &runCheckpoint{RunID: checkpoint.NewRunID(), Table: c.TableName, Bucket: c.Bucket, Files: files, Format: format, Operation: op}
+		log.Printf("restore run id %s", cp.RunID)
+	}
 
-	file.Seek(0, 0)
-	dec := json.NewDecoder(file)
-	itemsChan := make(chan map[string]interface{})
+	var keyAttrs []string
+	if policy.Mode == ConflictSkip || c.KeysFile != "" {
+		if keyAttrs, err = table.KeySchema(dynamodb.New(s), c.TableName); err != nil {
+			return err
+		}
+	}
+	var keys *keySet
+	if c.KeysFile != "" {
+		if keys, err = loadKeys(c.KeysFile, keyAttrs); err != nil {
+			return err
+		}
+	}
 
-	log.Println("starting dynmo writer")
-	//db := dynamodb.New(s)
-	grp, ctx := errgroup.WithContext(context.Background())
+	if c.Readers < 1 {
+		c.Readers = 1
+	}
 
-	log.Println("workers ", c.Workers)
-	for index := 0; index < c.Workers; index++ {
-		grp.Go(func() error {
-			return NewDynamoBatchWriter(dynamodb.New(s), c.TableName).Write(itemsChan)
-		})
+	r := &restorer{
+		session:     s,
+		checkpoints: newCheckpointer(cp, c.DryRun),
+		filter:      f,
+		transform:   t,
+		keys:        keys,
+		failures:    newCategoryCounts(),
+		workers:     c.Workers,
+		readers:     c.Readers,
+		format:      cp.Format,
+		columns:     columns,
+		newWriter:   func() DynamoWriter { return NewDynamoBatchWriter(dynamodb.New(s), c.TableName, nil) },
 	}
-	stop := false
 
-	for {
-		if stop {
-			break
+	stats := &WriteStats{}
+	var report *keyReport
+	var dryRun *dryRunStats
+	if c.DryRun {
+		keyTypes, err := table.KeyTypes(dynamodb.New(s), c.TableName)
+		if err != nil {
+			return err
 		}
-
-		var items []map[string]interface{}
-		err := dec.Decode(&items)
-		if err == io.EOF {
-			break
+		dryRun = &dryRunStats{failures: r.failures}
+		r.newWriter = func() DynamoWriter { return newDryRunWriter(keyTypes, dryRun) }
+	} else if c.CompareKeys {
+		report = newKeyReport(os.Stdout, keyAttrs)
+		r.newWriter = func() DynamoWriter {
+			return newDynamoKeyComparer(dynamodb.New(s), c.TableName, keyAttrs, report)
+		}
+	} else if policy.Conditional() {
+		hashKey := ""
+		if policy.Mode == ConflictSkip {
+			hashKey = keyAttrs[0]
+		}
+		r.newWriter = func() DynamoWriter {
+			return NewDynamoConditionalWriter(dynamodb.New(s), c.TableName, hashKey, policy, stats)
 		}
+		r.workers = c.PutConcurrency
+	}
 
-		if err != nil {
-			close(itemsChan)
-			return err
+	if err := r.restoreFiles(cp.Bucket, cp.Files); err != nil {
+		r.checkpoints.flush()
+		if !c.DryRun {
+			log.Printf("restore failed, continue it with --resume %s", cp.RunID)
 		}
-		for _, item := range items {
-			select {
-			case itemsChan <- item:
-			case <-ctx.Done():
-				stop = true
+		return err
+	}
+	r.checkpoints.remove()
+
+	if dryRun != nil {
+		logDryRun(c.TableName, dryRun)
+		return nil
+	}
+	if report != nil {
+		for _, key := range keys.unseen() {
+			if err := report.add(keyNotInArchive, key); err != nil {
+				return err
 			}
 		}
+		log.Printf("compared keys with %s: %s", c.TableName, report.summary())
+		return nil
 	}
-	close(itemsChan)
-	if err := grp.Wait(); err != nil {
-		return err
+	log.Printf("items which could not be restored: %s", r.failures)
+	if policy.Conditional() {
+		log.Printf("%d items written, %d items skipped (on-conflict %s)", stats.Written, stats.Skipped, policy.Mode)
 	}
 	log.Printf("completed restoring to %s", c.TableName)
 	return nil
 }
-
-func getNewAwsSession(region string) *session.Session {
-	awsconfig := defaults.Config().WithRegion(region) //.WithLogLevel(aws.LogDebug)
-	awsconfig.Credentials = defaults.CredChain(awsconfig, defaults.Handlers())
-	return session.New(awsconfig)
-}
@@ -0,0 +1,63 @@
+package restore
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// selectFiles works out which archive files to restore, they are restored in parallel. It also returns the
+// format of the files when it is known up front rather than detected from each file.
+func selectFiles(svc s3iface.S3API, c *DynamoResotreConfig) ([]string, string, error) {
+	switch {
+	case c.AsOf != "":
+		files, err := selectAsOf(svc, c)
+		return files, source.FormatAuto, err
+	case c.Export != "":
+		return source.SelectExport(svc, c.Bucket, c.Export)
+	case c.Manifest != "":
+		m, err := manifest.Read(svc, c.Bucket, c.Manifest)
+		if err != nil {
+			return nil, "", err
+		}
+		return partKeys(m), source.FormatAuto, nil
+	case c.PartsPrefix != "":
+		keys, err := source.ListParts(svc, c.Bucket, c.PartsPrefix)
+		if err != nil {
+			return nil, "", err
+		}
+		return keys, source.FormatAuto, nil
+	}
+	return []string{c.RestoreFile}, source.FormatAuto, nil
+}
+
+// selectAsOf finds the archive which restores the table to how it was at the as-of time
+func selectAsOf(svc s3iface.S3API, c *DynamoResotreConfig) ([]string, error) {
+	asOf, err := time.Parse(time.RFC3339, c.AsOf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid as-of timestamp %q, expected RFC3339 e.g. 2016-08-01T13:00:00Z", c.AsOf)
+	}
+
+	all, err := manifest.List(svc, c.Bucket, c.Prefix, c.TableName)
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.AsOf(all, asOf)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("restoring the archive completed at %s", m.CompletedAt.Format(time.RFC3339))
+	return partKeys(m), nil
+}
+
+func partKeys(m *manifest.Manifest) []string {
+	keys := make([]string, len(m.Parts))
+	for i, p := range m.Parts {
+		keys[i] = p.Key
+	}
+	return keys
+}
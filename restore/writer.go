@@ -4,71 +4,94 @@ import (
 	"log"
 	"time"
 
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/table"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
-type batchWriter struct {
-	db    dynamodbiface.DynamoDBAPI
-	table string
+// Item is an item to write to dynamo, Done is called once the writer has finished with it
+type Item struct {
+	Attributes map[string]interface{}
+	Done       func()
 }
 
-func (bw *batchWriter) writeBatch(requestsChan chan []*dynamodb.WriteRequest, delay time.Duration) error {
-	for reqs := range requestsChan {
-		resp, err := bw.db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]*dynamodb.WriteRequest{
-				bw.table: reqs,
-			},
-			ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
-		})
-		if len(resp.UnprocessedItems) != 0 {
-			log.Println("warning unprocessed items found")
-			log.Printf("retrying unprocessed items after %v", delay)
-			time.Sleep(delay)
-
-			// create a temporary channel and recurse.
-			queueWrites := make(chan []*dynamodb.WriteRequest, 1)
-			queueWrites <- resp.UnprocessedItems[bw.table]
-			close(queueWrites)
-			bw.writeBatch(queueWrites, 2*delay)
-		}
+type writeBatch struct {
+	requests []*dynamodb.WriteRequest
+	items    []*Item
+}
 
-		if err != nil {
+type batchWriter struct {
+	db      dynamodbiface.DynamoDBAPI
+	table   string
+	limiter *ratelimit.Limiter
+	// newRequest turns an item into the put or delete request of the batch
+	newRequest func(item map[string]interface{}) (*dynamodb.WriteRequest, error)
+}
+
+func (bw *batchWriter) writeBatch(batchChan chan *writeBatch, delay time.Duration) error {
+	for b := range batchChan {
+		if err := bw.writeRequests(b.requests, delay); err != nil {
 			return err
 		}
+		for _, item := range b.items {
+			item.Done()
+		}
 	}
 	return nil
 }
 
-func (bw *batchWriter) createBatchWrites(in chan map[string]interface{}) chan []*dynamodb.WriteRequest {
+func (bw *batchWriter) writeRequests(reqs []*dynamodb.WriteRequest, delay time.Duration) error {
+	resp, err := bw.db.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]*dynamodb.WriteRequest{
+			bw.table: reqs,
+		},
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	})
+	if err != nil {
+		return err
+	}
+	for _, cc := range resp.ConsumedCapacity {
+		bw.limiter.Wait(aws.Float64Value(cc.CapacityUnits))
+	}
+
+	if len(resp.UnprocessedItems) != 0 {
+		log.Println("warning unprocessed items found")
+		log.Printf("retrying unprocessed items after %v", delay)
+		time.Sleep(delay)
+		return bw.writeRequests(resp.UnprocessedItems[bw.table], 2*delay)
+	}
+	return nil
+}
+
+func (bw *batchWriter) createBatchWrites(in chan *Item) chan *writeBatch {
 	const flushSize = 25 // TODO: should be configurable
-	out := make(chan []*dynamodb.WriteRequest)
-	var chunk []*dynamodb.WriteRequest
+	out := make(chan *writeBatch)
+	chunk := &writeBatch{}
 	go func() {
 		defer close(out)
 		for obj := range in {
-			av, err := dynamodbattribute.MarshalMap(obj)
+			req, err := bw.newRequest(obj.Attributes)
 			if err != nil {
+				// the item can never be written, so it is done with rather than holding back the checkpoint.
 				log.Printf("error convernting to *dynamodb.AttributeValue: %v", err)
-				break
+				obj.Done()
+				continue
 			}
 
 			// build a chunk
-			chunk = append(chunk, &dynamodb.WriteRequest{
-				PutRequest: &dynamodb.PutRequest{
-					Item: av,
-				},
-			})
+			chunk.requests = append(chunk.requests, req)
+			chunk.items = append(chunk.items, obj)
 
-			if len(chunk) == flushSize {
+			if len(chunk.requests) == flushSize {
 				out <- chunk
-				chunk = nil
+				chunk = &writeBatch{}
 			}
 		}
 		// flush the remaining chunk.
-		if len(chunk) != 0 {
+		if len(chunk.requests) != 0 {
 			out <- chunk
 		}
 	}()
@@ -76,19 +99,55 @@ func (bw *batchWriter) createBatchWrites(in chan map[string]interface{}) chan []
 	return out
 }
 
-func (bw *batchWriter) Write(input chan map[string]interface{}) error {
+func newPutRequest(item map[string]interface{}) (*dynamodb.WriteRequest, error) {
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.WriteRequest{
+		PutRequest: &dynamodb.PutRequest{
+			Item: av,
+		},
+	}, nil
+}
+
+func (bw *batchWriter) Write(input chan *Item) error {
 	return bw.writeBatch(bw.createBatchWrites(input), 250*time.Millisecond)
 }
 
-// NewDynamoBatchWriter creates new dynamo writer which sends the data to dynamo in batches of 25 requests
-func NewDynamoBatchWriter(db dynamodbiface.DynamoDBAPI, table string) DynamoWriter {
+// NewDynamoBatchWriter creates new dynamo writer which sends the data to dynamo in batches of 25 requests. The
+// limiter, which can be nil, is shared by the writers to keep the write capacity they consume under its rate.
+func NewDynamoBatchWriter(db dynamodbiface.DynamoDBAPI, table string, limiter *ratelimit.Limiter) DynamoWriter {
+	return &batchWriter{
+		db:         db,
+		table:      table,
+		limiter:    limiter,
+		newRequest: newPutRequest,
+	}
+}
+
+// NewDynamoBatchDeleter creates new dynamo writer which deletes the items by their key attributes in batches of
+// 25 requests, sharing the limiter like NewDynamoBatchWriter.
+func NewDynamoBatchDeleter(db dynamodbiface.DynamoDBAPI, tableName string, keyAttrs []string, limiter *ratelimit.Limiter) DynamoWriter {
 	return &batchWriter{
-		db:    db,
-		table: table,
+		db:      db,
+		table:   tableName,
+		limiter: limiter,
+		newRequest: func(item map[string]interface{}) (*dynamodb.WriteRequest, error) {
+			av, err := dynamodbattribute.MarshalMap(table.Key(item, keyAttrs))
+			if err != nil {
+				return nil, err
+			}
+			return &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: av,
+				},
+			}, nil
+		},
 	}
 }
 
 // DynamoWriter provides the interface to write data to dynamo
 type DynamoWriter interface {
-	Write(input chan map[string]interface{}) error
+	Write(input chan *Item) error
 }
@@ -0,0 +1,65 @@
+package restore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// unmarshallable can not be turned into an attribute value
+type unmarshallable struct{}
+
+func (unmarshallable) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	return errors.New("unmarshallable")
+}
+
+// BatchWriteItem puts and deletes the requests of the fake table, processing all of them
+func (ft *fakeTable) BatchWriteItem(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if ft.err != nil {
+		return nil, ft.err
+	}
+	for _, reqs := range in.RequestItems {
+		for _, req := range reqs {
+			if req.PutRequest != nil {
+				ft.items[*req.PutRequest.Item["id"].S] = req.PutRequest.Item
+			}
+			if req.DeleteRequest != nil {
+				delete(ft.items, *req.DeleteRequest.Key["id"].S)
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestBatchWriterUnmarshallable(t *testing.T) {
+	db := newFakeTable(t)
+	w := NewDynamoBatchWriter(db, "jobs", nil)
+
+	// more items than a batch after the bad one, so the writer has to keep draining its input.
+	items := []map[string]interface{}{{"id": "before"}, {"id": "bad", "v": unmarshallable{}}}
+	for i := 0; i < 30; i++ {
+		items = append(items, map[string]interface{}{"id": string(rune('a' + i))})
+	}
+	in := make(chan *Item)
+	var mu sync.Mutex
+	var done int
+	go func() {
+		for _, item := range items {
+			in <- &Item{Attributes: item, Done: func() { mu.Lock(); done++; mu.Unlock() }}
+		}
+		close(in)
+	}()
+	if err := w.Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if done != len(items) {
+		t.Errorf("%d of %d items done", done, len(items))
+	}
+	if db.get(t, "bad") != nil || db.get(t, "before") == nil || db.get(t, "a") == nil || len(db.items) != len(items)-1 {
+		t.Errorf("wrote %d items, want every item but the bad one", len(db.items))
+	}
+}
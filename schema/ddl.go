@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+)
+
+// serdes for the archive formats athena can read
+const (
+	jsonSerDe = "org.openx.data.jsonserde.JsonSerDe"
+	csvSerDe  = "org.apache.hadoop.hive.serde2.OpenCSVSerde"
+)
+
+// athenaTypes maps the column types of a parquet archive to hive types
+var athenaTypes = map[string]string{
+	archive.ColumnString:  "string",
+	archive.ColumnInt64:   "bigint",
+	archive.ColumnDouble:  "double",
+	archive.ColumnBoolean: "boolean",
+	archive.ColumnBinary:  "binary",
+	archive.ColumnJSON:    "string",
+}
+
+var plainName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// layout is where an archive is and how it is written, which the table definition has to match
+type layout struct {
+	table       string
+	format      string
+	location    string
+	partitionBy string
+}
+
+// column is a column of the table definition
+type column struct {
+	name string
+	typ  string
+}
+
+// partitionColumn returns the attribute the archive is partitioned by, without the date granularity
+func (l *layout) partitionColumn() string {
+	if i := strings.LastIndex(l.partitionBy, ":"); i >= 0 {
+		return l.partitionBy[:i]
+	}
+	return l.partitionBy
+}
+
+// ddl writes the CREATE EXTERNAL TABLE statement for the archive, followed by the statement loading the
+// partitions of a partitioned archive.
+func ddl(l *layout, columns []column) (string, error) {
+	partition := l.partitionColumn()
+	var defs []string
+	for _, c := range columns {
+		if strings.EqualFold(c.name, partition) {
+			if l.format != archive.FormatCSV {
+				// the partition column takes the place of the attribute.
+				continue
+			}
+			// csv columns are read by position so the attribute stays, under another name.
+			c.name += "_value"
+		}
+		defs = append(defs, fmt.Sprintf("  `%s` %s", strings.ToLower(c.name), c.typ))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE EXTERNAL TABLE IF NOT EXISTS `%s` (\n%s\n)\n", l.table, strings.Join(defs, ",\n"))
+	if partition != "" {
+		fmt.Fprintf(&b, "PARTITIONED BY (`%s` string)\n", strings.ToLower(partition))
+	}
+	switch l.format {
+	case archive.FormatJSONLines:
+		fmt.Fprintf(&b, "ROW FORMAT SERDE '%s'\n", jsonSerDe)
+	case archive.FormatCSV:
+		fmt.Fprintf(&b, "ROW FORMAT SERDE '%s'\n", csvSerDe)
+		b.WriteString("WITH SERDEPROPERTIES ('separatorChar' = ',', 'quoteChar' = '\"', 'escapeChar' = '\\\\')\n")
+	case archive.FormatParquet:
+		b.WriteString("STORED AS PARQUET\n")
+	case archive.FormatJSON:
+		return "", fmt.Errorf("athena can not read %s archives which hold json arrays, archive with --format %s", l.format, archive.FormatJSONLines)
+	default:
+		return "", fmt.Errorf("no table definition for %q archives", l.format)
+	}
+	fmt.Fprintf(&b, "LOCATION '%s'", l.location)
+	if l.format == archive.FormatCSV {
+		// every part of a csv archive starts with a header.
+		b.WriteString("\nTBLPROPERTIES ('skip.header.line.count' = '1')")
+	}
+	b.WriteString(";\n")
+	if partition != "" {
+		fmt.Fprintf(&b, "\nMSCK REPAIR TABLE `%s`;\n", l.table)
+	}
+	return b.String(), nil
+}
+
+// hiveName quotes names which are not plain identifiers, for struct fields
+func hiveName(name string) string {
+	if plainName.MatchString(name) {
+		return name
+	}
+	return "`" + name + "`"
+}
+
+// tableName turns a dynamodb table name into a name athena accepts
+func tableName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(name))
+}
@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// dynamodb types of the values seen, in the order they are listed in a union
+var kinds = []string{"S", "N", "BOOL", "B", "M", "L", "SS", "NS", "BS", "NULL"}
+
+// node is the inferred type of an attribute, or of a map field or list element. An attribute whose type varies
+// between items has more than one kind, which is a union.
+type node struct {
+	// seen is the number of values and maps the number of them which were maps
+	seen     int64
+	kinds    map[string]int64
+	fraction bool
+	fields   map[string]*node
+	maps     int64
+	elem     *node
+}
+
+func newNode() *node {
+	return &node{kinds: map[string]int64{}}
+}
+
+func (n *node) add(v interface{}) {
+	n.seen++
+	switch v := v.(type) {
+	case nil:
+		n.kinds["NULL"]++
+	case string:
+		n.kinds["S"]++
+	case float64:
+		n.kinds["N"]++
+		n.fraction = n.fraction || v != float64(int64(v))
+	case bool:
+		n.kinds["BOOL"]++
+	case []byte:
+		n.kinds["B"]++
+	case map[string]interface{}:
+		n.kinds["M"]++
+		n.maps++
+		if n.fields == nil {
+			n.fields = map[string]*node{}
+		}
+		for name, fv := range v {
+			f, ok := n.fields[name]
+			if !ok {
+				f = newNode()
+				n.fields[name] = f
+			}
+			f.add(fv)
+		}
+	case []interface{}:
+		n.kinds["L"]++
+		n.addElems(len(v), func(i int) interface{} { return v[i] })
+	case []string:
+		n.kinds["SS"]++
+	case []float64:
+		n.kinds["NS"]++
+		n.addElems(len(v), func(i int) interface{} { return v[i] })
+	case [][]byte:
+		n.kinds["BS"]++
+	case dynamodbattribute.Marshaler:
+		// the sets decoded from csv archives.
+		av := &dynamodb.AttributeValue{}
+		if err := v.MarshalDynamoDBAttributeValue(av); err == nil && av.NS != nil {
+			n.kinds["NS"]++
+		} else {
+			n.kinds["SS"]++
+		}
+	default:
+		n.kinds["S"]++
+	}
+}
+
+func (n *node) addElems(count int, elem func(i int) interface{}) {
+	if n.elem == nil {
+		n.elem = newNode()
+	}
+	for i := 0; i < count; i++ {
+		n.elem.add(elem(i))
+	}
+}
+
+// union returns the kinds of the node other than null, most common first
+func (n *node) union() []string {
+	var union []string
+	for _, k := range kinds {
+		if k != "NULL" && n.kinds[k] != 0 {
+			union = append(union, k)
+		}
+	}
+	sort.SliceStable(union, func(i, j int) bool { return n.kinds[union[i]] > n.kinds[union[j]] })
+	return union
+}
+
+// names returns the fields of a map node sorted by name
+func (n *node) names() []string {
+	names := make([]string, 0, len(n.fields))
+	for name := range n.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// required reports whether the field is in every map the node has seen
+func (n *node) required(name string) bool {
+	f := n.fields[name]
+	return f.seen == n.maps && f.kinds["NULL"] == 0
+}
+
+// jsonSchema returns the draft-07 json schema of the node
+func (n *node) jsonSchema() map[string]interface{} {
+	var anyOf []interface{}
+	for _, k := range n.union() {
+		anyOf = append(anyOf, n.kindSchema(k))
+	}
+	if n.kinds["NULL"] != 0 {
+		anyOf = append(anyOf, map[string]interface{}{"type": "null"})
+	}
+	switch len(anyOf) {
+	case 0:
+		return map[string]interface{}{}
+	case 1:
+		return anyOf[0].(map[string]interface{})
+	}
+	return map[string]interface{}{"anyOf": anyOf}
+}
+
+func (n *node) kindSchema(kind string) map[string]interface{} {
+	number := "integer"
+	if n.fraction {
+		number = "number"
+	}
+	switch kind {
+	case "S":
+		return map[string]interface{}{"type": "string"}
+	case "N":
+		return map[string]interface{}{"type": number}
+	case "BOOL":
+		return map[string]interface{}{"type": "boolean"}
+	case "B":
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case "M":
+		properties := map[string]interface{}{}
+		var required []string
+		for _, name := range n.names() {
+			properties[name] = n.fields[name].jsonSchema()
+			if n.required(name) {
+				required = append(required, name)
+			}
+		}
+		s := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) != 0 {
+			s["required"] = required
+		}
+		return s
+	case "L":
+		items := map[string]interface{}{}
+		if n.elem != nil {
+			items = n.elem.jsonSchema()
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	case "SS":
+		return map[string]interface{}{"type": "array", "uniqueItems": true, "items": map[string]interface{}{"type": "string"}}
+	case "NS":
+		if n.elem != nil && n.elem.fraction {
+			number = "number"
+		}
+		return map[string]interface{}{"type": "array", "uniqueItems": true, "items": map[string]interface{}{"type": number}}
+	case "BS":
+		return map[string]interface{}{"type": "array", "uniqueItems": true, "items": map[string]interface{}{"type": "string", "contentEncoding": "base64"}}
+	}
+	return map[string]interface{}{}
+}
+
+// athenaType returns the hive type of the node for the json serde. Unions are read as strings, which the serde
+// fills with the json text of maps and lists.
+func (n *node) athenaType() string {
+	union := n.union()
+	if len(union) != 1 {
+		return "string"
+	}
+	switch union[0] {
+	case "N":
+		if n.fraction {
+			return "double"
+		}
+		return "bigint"
+	case "BOOL":
+		return "boolean"
+	case "M":
+		if len(n.fields) == 0 {
+			return "string"
+		}
+		fields := ""
+		for i, name := range n.names() {
+			if i > 0 {
+				fields += ","
+			}
+			fields += hiveName(name) + ":" + n.fields[name].athenaType()
+		}
+		return "struct<" + fields + ">"
+	case "L":
+		if n.elem == nil {
+			return "array<string>"
+		}
+		return "array<" + n.elem.athenaType() + ">"
+	case "SS", "BS":
+		return "array<string>"
+	case "NS":
+		if n.elem != nil && n.elem.fraction {
+			return "array<double>"
+		}
+		return "array<bigint>"
+	}
+	return "string"
+}
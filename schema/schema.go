@@ -0,0 +1,275 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errSampled stops the table scan once enough items have been sampled
+var errSampled = errors.New("sampled enough items")
+
+// InferConfig provides the configuration for inferring the schema of an archive or a table
+type InferConfig struct {
+	Region         string
+	TableName      string
+	Bucket         string
+	Source         string
+	Sample         int
+	ScanPartitions int
+	ScanLimit      int
+	// Name, Format, Location and PartitionBy describe the athena table, they default to what the manifest says
+	Name           string
+	Format         string
+	Location       string
+	PartitionBy    string
+	JSONSchemaFile string
+	DDLFile        string
+}
+
+// Infer reads the archive, or samples the table, and writes the inferred schema as json schema and as the athena
+// table definition of the archive. Parquet archives are not read, their schema is in the footer of the first part.
+func Infer(c *InferConfig) error {
+	s := awssession.New(c.Region)
+	l := &layout{table: c.TableName, format: archive.FormatJSONLines}
+
+	var root *node
+	var columns []column
+	if c.Source == "" {
+		var err error
+		if root, err = sampleTable(s, c); err != nil {
+			return err
+		}
+	} else {
+		bucket, key := source.ParseURI(c.Source, c.Bucket)
+		if bucket == "" {
+			return fmt.Errorf("missing bucket for %s", c.Source)
+		}
+		svc := s3.New(s)
+		if err := readLayout(svc, bucket, key, l); err != nil {
+			return err
+		}
+		files, err := source.Files(svc, bucket, key)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no archive files found for %s", c.Source)
+		}
+		if l.format == archive.FormatParquet {
+			columns, err = parquetColumns(s, bucket, files[0])
+		} else {
+			root, err = sampleArchive(svc, bucket, files, c.Sample)
+		}
+		if err != nil {
+			return err
+		}
+		if l.format == archive.FormatCSV {
+			if columns, err = csvColumns(svc, bucket, files[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.Name != "" {
+		l.table = c.Name
+	}
+	l.table = tableName(l.table)
+	if c.Format != "" {
+		l.format = c.Format
+	}
+	if c.Location != "" {
+		l.location = c.Location
+	}
+	if c.PartitionBy != "" {
+		l.partitionBy = c.PartitionBy
+	}
+	if columns == nil && root != nil {
+		for _, name := range root.names() {
+			columns = append(columns, column{name: name, typ: root.fields[name].athenaType()})
+		}
+	}
+
+	if c.JSONSchemaFile == "" && c.DDLFile == "" {
+		c.JSONSchemaFile = "-"
+	}
+	if c.JSONSchemaFile != "" {
+		s := map[string]interface{}{"type": "object"}
+		if root != nil {
+			s = root.kindSchema("M")
+		} else {
+			s["properties"] = parquetSchema(columns)
+		}
+		s["$schema"] = "http://json-schema.org/draft-07/schema#"
+		s["title"] = l.table
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeOut(c.JSONSchemaFile, append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	if c.DDLFile != "" {
+		if l.location == "" {
+			return errors.New("missing location of the archive for the table definition")
+		}
+		d, err := ddl(l, columns)
+		if err != nil {
+			return err
+		}
+		if err := writeOut(c.DDLFile, []byte(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLayout fills in the layout from the manifest, when the source is one
+func readLayout(svc *s3.S3, bucket, key string, l *layout) error {
+	if !manifest.IsManifest(key) {
+		return nil
+	}
+	m, err := manifest.Read(svc, bucket, key)
+	if err != nil {
+		return err
+	}
+	baseKey := manifest.BaseKey(key)
+	l.table, l.format, l.partitionBy = m.Table, m.Format, m.PartitionBy
+	if l.format == "" {
+		l.format = archive.FormatJSON
+	}
+	for _, p := range m.Parts {
+		if !strings.HasPrefix(p.Key, baseKey+"/") {
+			log.Printf("%s is a single object next to its manifest, athena needs the parts in a folder of their own, archive with --part-size or --part-items", p.Key)
+			return nil
+		}
+	}
+	l.location = "s3://" + bucket + "/" + baseKey + "/"
+	return nil
+}
+
+// sampleTable scans the table until it has sampled enough items
+func sampleTable(s *session.Session, c *InferConfig) (*node, error) {
+	root := newNode()
+	sampled := 0
+	log.Printf("sampling %d items of %s", c.Sample, c.TableName)
+	err := archive.ScanTable(dynamodb.New(s), c.TableName, c.ScanPartitions, c.ScanLimit, func(items []map[string]interface{}) error {
+		for _, item := range items {
+			if c.Sample > 0 && sampled == c.Sample {
+				return errSampled
+			}
+			root.add(item)
+			sampled++
+		}
+		return nil
+	})
+	if err != nil && err != errSampled {
+		return nil, err
+	}
+	return root, nil
+}
+
+// sampleArchive reads the files of the archive in order until it has sampled enough items, all of them for
+// a sample of 0.
+func sampleArchive(svc *s3.S3, bucket string, files []string, sample int) (*node, error) {
+	root := newNode()
+	sampled := 0
+	for _, file := range files {
+		err := source.Stream(svc, bucket, file, nil, func(items []map[string]interface{}) error {
+			for _, item := range items {
+				if sample > 0 && sampled == sample {
+					return source.ErrStop
+				}
+				root.add(item)
+				sampled++
+			}
+			return nil
+		})
+		if err == source.ErrStop {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("inferred the schema from %d items", sampled)
+	return root, nil
+}
+
+// csvColumns reads the header of a csv archive file, columns are read by position so they all become strings
+func csvColumns(svc *s3.S3, bucket, key string) ([]column, error) {
+	out, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	header, err := source.CSVHeader(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error %s whilst reading the header of %s", err, key)
+	}
+	columns := make([]column, len(header))
+	for i, name := range header {
+		columns[i] = column{name: tableName(name), typ: "string"}
+	}
+	return columns, nil
+}
+
+// parquetColumns reads the schema from the footer of a parquet archive file
+func parquetColumns(s *session.Session, bucket, key string) ([]column, error) {
+	file, err := source.Download(s, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	schema, err := archive.ReadParquetSchema(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("error %s whilst reading the schema of %s", err, key)
+	}
+	columns := make([]column, len(schema))
+	for i, c := range schema {
+		typ, ok := athenaTypes[c.Type]
+		if !ok {
+			typ = "string"
+		}
+		columns[i] = column{name: c.Name, typ: typ}
+	}
+	return columns, nil
+}
+
+// parquetSchema returns the json schema properties of parquet columns, which are all optional
+func parquetSchema(columns []column) map[string]interface{} {
+	types := map[string]string{"string": "string", "bigint": "integer", "double": "number", "boolean": "boolean", "binary": "string"}
+	properties := map[string]interface{}{}
+	for _, c := range columns {
+		properties[c.name] = map[string]interface{}{"type": []string{types[c.typ], "null"}}
+	}
+	return properties
+}
+
+// writeOut writes to the file, or to stdout for -
+func writeOut(path string, b []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,100 @@
+package source
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// stringSet is written to dynamo as a string set rather than a list
+type stringSet []string
+
+func (s stringSet) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	if len(s) == 0 {
+		av.NULL = aws.Bool(true)
+		return nil
+	}
+	av.SS = aws.StringSlice(s)
+	return nil
+}
+
+// numberSet is written to dynamo as a number set rather than a list, the members are kept as written so none
+// of their digits are lost
+type numberSet []string
+
+func (s numberSet) MarshalDynamoDBAttributeValue(av *dynamodb.AttributeValue) error {
+	if len(s) == 0 {
+		av.NULL = aws.Bool(true)
+		return nil
+	}
+	av.NS = aws.StringSlice(s)
+	return nil
+}
+
+// ItemFromAttributes converts an item of typed attribute values like dynamodbattribute.UnmarshalMap, except that
+// sets stay sets and numbers a float64 can not hold exactly keep all their digits.
+func ItemFromAttributes(attrs map[string]*dynamodb.AttributeValue) (map[string]interface{}, error) {
+	item := make(map[string]interface{}, len(attrs))
+	for name, av := range attrs {
+		v, err := fromAttribute(av)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", name, err)
+		}
+		item[name] = v
+	}
+	return item, nil
+}
+
+func fromAttribute(av *dynamodb.AttributeValue) (interface{}, error) {
+	switch {
+	case av.S != nil:
+		return *av.S, nil
+	case av.N != nil:
+		return parseNumber(*av.N)
+	case av.B != nil:
+		return av.B, nil
+	case av.BOOL != nil:
+		return *av.BOOL, nil
+	case av.NULL != nil:
+		return nil, nil
+	case av.M != nil:
+		return ItemFromAttributes(av.M)
+	case av.L != nil:
+		l := make([]interface{}, len(av.L))
+		for i, e := range av.L {
+			v, err := fromAttribute(e)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = v
+		}
+		return l, nil
+	case av.SS != nil:
+		return stringSet(aws.StringValueSlice(av.SS)), nil
+	case av.NS != nil:
+		return numberSet(aws.StringValueSlice(av.NS)), nil
+	case av.BS != nil:
+		return av.BS, nil
+	}
+	return nil, fmt.Errorf("empty attribute value")
+}
+
+// parseNumber returns the number as a float64, so where filters and transforms can compare it, unless that would
+// change its value. Dynamo numbers have up to 38 digits, those are kept as a dynamodbattribute.Number.
+func parseNumber(n string) (interface{}, error) {
+	exact, ok := new(big.Rat).SetString(n)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", n)
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err == nil {
+		if r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64)); ok && r.Cmp(exact) == 0 {
+			return f, nil
+		}
+	}
+	return dynamodbattribute.Number(n), nil
+}
@@ -0,0 +1,197 @@
+package source
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// csvTypes are the attribute types a csv column can be mapped to, M and L cells hold json
+var csvTypes = map[string]bool{"S": true, "N": true, "BOOL": true, "SS": true, "NS": true, "M": true, "L": true}
+
+// CSVMapping maps the columns of a csv file to typed attributes. Columns without a type are strings.
+type CSVMapping struct {
+	columns []string
+	types   map[string]string
+	header  bool
+}
+
+// ParseCSVMapping parses a comma separated list of name:TYPE columns. Without a header row the list also
+// gives the order of the columns.
+func ParseCSVMapping(columns string, noHeader bool) (*CSVMapping, error) {
+	m := &CSVMapping{types: map[string]string{}, header: !noHeader}
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			continue
+		}
+		name, typ := column, "S"
+		if i := strings.LastIndex(column, ":"); i >= 0 {
+			name, typ = column[:i], strings.ToUpper(column[i+1:])
+		}
+		if !csvTypes[typ] {
+			return nil, fmt.Errorf("unknown type %s for csv column %s, expected S, N, BOOL, SS, NS, M or L", typ, name)
+		}
+		m.columns = append(m.columns, name)
+		m.types[name] = typ
+	}
+	if noHeader && len(m.columns) == 0 {
+		return nil, fmt.Errorf("csv files without a header need the columns")
+	}
+	return m, nil
+}
+
+func defaultCSVMapping() *CSVMapping {
+	return &CSVMapping{types: map[string]string{}, header: true}
+}
+
+// IsCSV tells a csv file from its key, gzipped or not
+func IsCSV(key string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(key, ".gz"), ".csv")
+}
+
+// readCSVHeader reads the header row, returning the column names and the number of bytes it took up. The csv
+// reader shares br rather than buffering ahead of it, so br is left at the start of the first row.
+func readCSVHeader(br *bufio.Reader, m *CSVMapping) ([]string, int64, error) {
+	if !m.header {
+		return m.columns, 0, nil
+	}
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error %s whilst reading the csv header", err)
+	}
+	// spreadsheets often start the file with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	return header, cr.InputOffset(), nil
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	mapping *CSVMapping
+	header  []string
+	start   int64
+}
+
+func newCSVDecoder(r io.Reader, m *CSVMapping, header []string, start int64) *csvDecoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvDecoder{r: cr, mapping: m, header: header, start: start}
+}
+
+func (d *csvDecoder) Next() ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	for len(items) < linesChunk {
+		record, err := d.r.Read()
+		if err == io.EOF && len(items) != 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > len(d.header) {
+			line, _ := d.r.FieldPos(0)
+			return nil, fmt.Errorf("row on line %d has %d cells but there are %d columns", line, len(record), len(d.header))
+		}
+		item := map[string]interface{}{}
+		for i, cell := range record {
+			if cell == "" {
+				continue
+			}
+			name := d.header[i]
+			v, err := csvValue(cell, d.mapping.types[name])
+			if err != nil {
+				line, _ := d.r.FieldPos(i)
+				return nil, fmt.Errorf("column %s on line %d: %v", name, line, err)
+			}
+			item[name] = v
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *csvDecoder) Offset() int64 {
+	return d.start + d.r.InputOffset()
+}
+
+// csvValue converts a cell to an attribute of the type, sets are json arrays or values separated by |
+func csvValue(cell, typ string) (interface{}, error) {
+	switch typ {
+	case "N":
+		return parseNumber(strings.TrimSpace(cell))
+	case "BOOL":
+		return strconv.ParseBool(strings.TrimSpace(cell))
+	case "SS":
+		return splitSet(cell)
+	case "NS":
+		values, err := splitSet(cell)
+		if err != nil {
+			return nil, err
+		}
+		// dynamo refuses sets with the same number twice, however it is written.
+		var set numberSet
+		seen := map[string]bool{}
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			r, ok := new(big.Rat).SetString(v)
+			if !ok {
+				return nil, fmt.Errorf("invalid number %q", v)
+			}
+			if !seen[r.RatString()] {
+				seen[r.RatString()] = true
+				set = append(set, v)
+			}
+		}
+		return set, nil
+	case "M", "L":
+		var v interface{}
+		if err := json.Unmarshal([]byte(cell), &v); err != nil {
+			return nil, err
+		}
+		if _, ok := v.(map[string]interface{}); typ == "M" && !ok {
+			return nil, fmt.Errorf("expected a json object")
+		}
+		if _, ok := v.([]interface{}); typ == "L" && !ok {
+			return nil, fmt.Errorf("expected a json array")
+		}
+		return v, nil
+	}
+	return cell, nil
+}
+
+// splitSet splits the members of a set cell, leaving out any repeated member as dynamo refuses sets with them
+func splitSet(cell string) (stringSet, error) {
+	var values []string
+	if strings.HasPrefix(strings.TrimSpace(cell), "[") {
+		if err := json.Unmarshal([]byte(cell), &values); err != nil {
+			return nil, err
+		}
+	} else {
+		values = strings.Split(cell, "|")
+	}
+	var set stringSet
+	seen := map[string]bool{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			set = append(set, v)
+		}
+	}
+	return set, nil
+}
+
+// CSVHeader reads the header row at the start of a csv archive file
+func CSVHeader(r io.Reader) ([]string, error) {
+	header, _, err := readCSVHeader(bufio.NewReader(r), defaultCSVMapping())
+	return header, err
+}
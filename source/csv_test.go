@@ -0,0 +1,74 @@
+package source
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestCSVHeader(t *testing.T) {
+	data := "\ufeffid,\"multi\nline\",n\na,\"b\nc\",1\nd,e,2\n"
+	mapping, err := ParseCSVMapping("n:N", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"id": "a", "multi\nline": "b\nc", "n": 1.0},
+		{"id": "d", "multi\nline": "e", "n": 2.0},
+	}
+
+	dec, err := OpenReader(strings.NewReader(data), FormatCSV, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, _ := readChunks(t, dec)
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("read %v, want %v", items, want)
+	}
+
+	// an offset inside the header continues from the first row.
+	f := tempFile(t, data)
+	dec, err = Open(f, FormatCSV, 5, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, _ = readChunks(t, dec); !reflect.DeepEqual(items, want) {
+		t.Errorf("read %v from offset 5, want %v", items, want)
+	}
+}
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		cell string
+		typ  string
+		want interface{}
+	}{
+		{"text", "S", "text"},
+		{" 1.5 ", "N", 1.5},
+		{"12345678901234567890123", "N", dynamodbattribute.Number("12345678901234567890123")},
+		{"true", "BOOL", true},
+		{"a|b|a", "SS", stringSet{"a", "b"}},
+		{`["a","b","b"]`, "SS", stringSet{"a", "b"}},
+		{"1|1.0|2| 1 ", "NS", numberSet{"1", "2"}},
+		{`{"a":1}`, "M", map[string]interface{}{"a": 1.0}},
+		{`[1,"x"]`, "L", []interface{}{1.0, "x"}},
+	}
+	for _, tt := range tests {
+		got, err := csvValue(tt.cell, tt.typ)
+		if err != nil {
+			t.Errorf("%q as %s: %s", tt.cell, tt.typ, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q as %s is %#v, want %#v", tt.cell, tt.typ, got, tt.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"x", "N"}, {"1|x", "NS"}, {"[1]", "M"}, {"{}", "L"}, {"maybe", "BOOL"}} {
+		if v, err := csvValue(bad[0], bad[1]); err == nil {
+			t.Errorf("%q as %s gave %#v, expected an error", bad[0], bad[1], v)
+		}
+	}
+}
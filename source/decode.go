@@ -0,0 +1,230 @@
+package source
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// FormatAuto tells an array per page archive from a json lines one by looking at the file
+	FormatAuto = ""
+	// FormatJSONArray is an archive with a json array of items per scanned page
+	FormatJSONArray = "json"
+	// FormatJSONLines is an archive with a json object per item, one per line
+	FormatJSONLines = "jsonl"
+	// FormatDynamoJSON is the DynamoDB JSON of the AWS managed export, one {"Item": {...}} per line
+	FormatDynamoJSON = "dynamodb-json"
+	// FormatIon is the Amazon Ion text of the AWS managed export, one {Item: {...}} per line
+	FormatIon = "ion"
+	// FormatCSV is a csv file with a row per item, mapped to attributes by a CSVMapping
+	FormatCSV = "csv"
+
+	// linesChunk is how many items of a line based file are decoded and checkpointed together
+	linesChunk = 100
+)
+
+// Decoder decodes the items of an archive file a chunk at a time
+type Decoder interface {
+	// Next returns the next chunk of items, or io.EOF at the end of the file
+	Next() ([]map[string]interface{}, error)
+	// Offset is the position in the decompressed file just after the last chunk
+	Offset() int64
+}
+
+// Open creates the decoder for the file, decompressing it if it is gzipped and continuing from offset
+func Open(file *os.File, format string, offset int64, columns *CSVMapping) (Decoder, error) {
+	if columns == nil {
+		columns = defaultCSVMapping()
+	}
+	file.Seek(0, 0)
+	r, gzipped, err := decompress(file)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	if format == FormatAuto {
+		if format, err = detectFormat(br); err != nil {
+			return nil, err
+		}
+	}
+
+	// the header of a csv file is needed wherever it continues from.
+	var header []string
+	var consumed int64
+	if format == FormatCSV {
+		if header, consumed, err = readCSVHeader(br, columns); err != nil {
+			return nil, err
+		}
+		if offset < consumed {
+			offset = consumed
+		}
+	}
+
+	// offsets are positions in the decompressed data, so a gzipped file has to be read up to them.
+	if gzipped {
+		if _, err := io.CopyN(ioutil.Discard, br, offset-consumed); err != nil {
+			return nil, err
+		}
+	} else {
+		file.Seek(offset, 0)
+		br = bufio.NewReader(file)
+	}
+
+	return newDecoder(br, format, offset, header, columns)
+}
+
+// OpenReader creates the decoder for an archive file streamed from its start, decompressing it if it is gzipped
+func OpenReader(r io.Reader, format string, columns *CSVMapping) (Decoder, error) {
+	if columns == nil {
+		columns = defaultCSVMapping()
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+
+	var err error
+	if format == FormatAuto {
+		if format, err = detectFormat(br); err != nil {
+			return nil, err
+		}
+	}
+	var header []string
+	var start int64
+	if format == FormatCSV {
+		if header, start, err = readCSVHeader(br, columns); err != nil {
+			return nil, err
+		}
+	}
+	return newDecoder(br, format, start, header, columns)
+}
+
+func newDecoder(br *bufio.Reader, format string, offset int64, header []string, columns *CSVMapping) (Decoder, error) {
+	switch format {
+	case FormatJSONArray, FormatJSONLines:
+		return &jsonDecoder{dec: json.NewDecoder(br), lines: format == FormatJSONLines, start: offset}, nil
+	case FormatDynamoJSON:
+		return &dynamoJSONDecoder{dec: json.NewDecoder(br), start: offset}, nil
+	case FormatIon:
+		return newIonDecoder(br, offset), nil
+	case FormatCSV:
+		return newCSVDecoder(br, columns, header, offset), nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+func decompress(file *os.File) (io.Reader, bool, error) {
+	magic := make([]byte, 2)
+	n, err := io.ReadFull(file, magic)
+	file.Seek(0, 0)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, false, err
+	}
+	if n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, false, err
+		}
+		return gz, true, nil
+	}
+	return file, false, nil
+}
+
+// detectFormat looks at the start of the file to tell a json lines archive, one object per line, from one
+// with an array of items per page.
+func detectFormat(br *bufio.Reader) (string, error) {
+	if b, _ := br.Peek(4); string(b) == "PAR1" {
+		return "", fmt.Errorf("parquet archives are for analytics and can not be restored")
+	}
+	for i := 1; ; i++ {
+		b, err := br.Peek(i)
+		if err == io.EOF {
+			return FormatJSONArray, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return FormatJSONLines, nil
+		}
+		return FormatJSONArray, nil
+	}
+}
+
+type jsonDecoder struct {
+	dec   *json.Decoder
+	lines bool
+	start int64
+}
+
+// next decodes the next page of an array per page archive, or the next lines of a json lines one
+func (d *jsonDecoder) Next() ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	if !d.lines {
+		err := d.dec.Decode(&items)
+		return items, err
+	}
+
+	for len(items) < linesChunk {
+		var item map[string]interface{}
+		err := d.dec.Decode(&item)
+		if err == io.EOF && len(items) != 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *jsonDecoder) Offset() int64 {
+	return d.start + d.dec.InputOffset()
+}
+
+type dynamoJSONDecoder struct {
+	dec   *json.Decoder
+	start int64
+}
+
+func (d *dynamoJSONDecoder) Next() ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	for len(items) < linesChunk {
+		var line struct {
+			Item map[string]*dynamodb.AttributeValue
+		}
+		err := d.dec.Decode(&line)
+		if err == io.EOF && len(items) != 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		item, err := ItemFromAttributes(line.Item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (d *dynamoJSONDecoder) Offset() int64 {
+	return d.start + d.dec.InputOffset()
+}
@@ -0,0 +1,138 @@
+package source
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// tempFile writes the archive to a temporary file, which is removed at the end of the test
+func tempFile(t *testing.T, data string) *os.File {
+	f, err := ioutil.TempFile("", "dynamotools-source-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Close()
+		os.Remove(f.Name())
+	})
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// readChunks reads every chunk of the decoder, returning the items and the offset after each chunk
+func readChunks(t *testing.T, dec Decoder) ([]map[string]interface{}, []int64) {
+	var items []map[string]interface{}
+	var offsets []int64
+	for {
+		chunk, err := dec.Next()
+		if err == io.EOF {
+			return items, offsets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, chunk...)
+		offsets = append(offsets, dec.Offset())
+	}
+}
+
+func TestDecodeTypes(t *testing.T) {
+	want := map[string]interface{}{
+		"id":    "a",
+		"n":     1.5,
+		"big":   dynamodbattribute.Number("12345678901234567890123"),
+		"ok":    true,
+		"none":  nil,
+		"bin":   []byte("hi"),
+		"tags":  stringSet{"x", "y"},
+		"nums":  numberSet{"1", "12345678901234567890123"},
+		"list":  []interface{}{"x", 2.0},
+		"inner": map[string]interface{}{"s": "v"},
+	}
+	tests := []struct {
+		format string
+		data   string
+	}{
+		{FormatDynamoJSON, `{"Item":{"id":{"S":"a"},"n":{"N":"1.5"},"big":{"N":"12345678901234567890123"},"ok":{"BOOL":true},` +
+			`"none":{"NULL":true},"bin":{"B":"aGk="},"tags":{"SS":["x","y"]},"nums":{"NS":["1","12345678901234567890123"]},` +
+			`"list":{"L":[{"S":"x"},{"N":"2"}]},"inner":{"M":{"s":{"S":"v"}}}}}` + "\n"},
+		{FormatIon, `$ion_1_0 {Item:{id:"a",n:1.5,big:12345678901234567890123.,ok:true,none:null,bin:{{aGk=}},` +
+			`tags:$dynamodb_SS::["x","y"],nums:$dynamodb_NS::[1,12345678901234567890123],list:["x",2],inner:{s:"v"}}}` + "\n"},
+	}
+	for _, tt := range tests {
+		dec, err := OpenReader(strings.NewReader(tt.data), tt.format, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.format, err)
+		}
+		items, _ := readChunks(t, dec)
+		if len(items) != 1 {
+			t.Fatalf("%s: decoded %d items", tt.format, len(items))
+		}
+		for name, v := range want {
+			if !reflect.DeepEqual(items[0][name], v) {
+				t.Errorf("%s: %s is %#v, want %#v", tt.format, name, items[0][name], v)
+			}
+		}
+
+		// the sets and the digits of the numbers survive being written back to dynamo.
+		av, err := dynamodbattribute.MarshalMap(items[0])
+		if err != nil {
+			t.Fatalf("%s: %s", tt.format, err)
+		}
+		if len(av["tags"].SS) != 2 || len(av["nums"].NS) != 2 || *av["big"].N != "12345678901234567890123" {
+			t.Errorf("%s: marshalled to %v", tt.format, av)
+		}
+	}
+}
+
+func TestDecodeResume(t *testing.T) {
+	line := map[string]func(i int) string{
+		FormatJSONLines:  func(i int) string { return `{"id":"` + strings.Repeat("x", i) + `"}` },
+		FormatDynamoJSON: func(i int) string { return `{"Item":{"id":{"S":"` + strings.Repeat("x", i) + `"}}}` },
+		FormatIon:        func(i int) string { return `$ion_1_0 {Item:{id:"` + strings.Repeat("x", i) + `"}}` },
+		FormatCSV:        func(i int) string { return strings.Repeat("x", i) },
+	}
+	for format, item := range line {
+		var data strings.Builder
+		if format == FormatCSV {
+			data.WriteString("id\n")
+		}
+		for i := 1; i <= 2*linesChunk+10; i++ {
+			data.WriteString(item(i) + "\n")
+		}
+		f := tempFile(t, data.String())
+
+		dec, err := Open(f, format, 0, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		all, offsets := readChunks(t, dec)
+		if len(all) != 2*linesChunk+10 || len(offsets) != 3 {
+			t.Fatalf("%s: decoded %d items in %d chunks", format, len(all), len(offsets))
+		}
+
+		// continuing from the offset of each chunk gives exactly the items after it.
+		for i, offset := range offsets {
+			dec, err := Open(f, format, offset, nil)
+			if err != nil {
+				t.Fatalf("%s: %s", format, err)
+			}
+			rest, _ := readChunks(t, dec)
+			from := (i + 1) * linesChunk
+			if from > len(all) {
+				from = len(all)
+			}
+			if !reflect.DeepEqual(rest, all[from:]) && !(len(rest) == 0 && from == len(all)) {
+				t.Errorf("%s: resuming from %d gave %d items starting %v, want %d", format, offset, len(rest), rest[:1], len(all)-from)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package source
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// exportSummaryFile is the summary the AWS managed export to s3 writes next to its data
+const exportSummaryFile = "manifest-summary.json"
+
+// exportSummary is the part of manifest-summary.json needed to find the data files of an export
+type exportSummary struct {
+	ExportArn          string `json:"exportArn"`
+	ItemCount          int64  `json:"itemCount"`
+	OutputFormat       string `json:"outputFormat"`
+	ManifestFilesS3Key string `json:"manifestFilesS3Key"`
+}
+
+// exportFile is a line of manifest-files.json
+type exportFile struct {
+	ItemCount     int64  `json:"itemCount"`
+	DataFileS3Key string `json:"dataFileS3Key"`
+}
+
+// SelectExport finds the data files of an AWS managed export from its manifest-summary.json, key can be the
+// summary itself or the prefix of the export it is in. It returns the keys of the data files and their format.
+func SelectExport(svc s3iface.S3API, bucket, key string) ([]string, string, error) {
+	if !strings.HasSuffix(key, exportSummaryFile) {
+		key = strings.TrimSuffix(key, "/") + "/" + exportSummaryFile
+	}
+
+	summary := &exportSummary{}
+	if err := readExportObject(svc, bucket, key, func(s *bufio.Scanner) error {
+		var data []byte
+		for s.Scan() {
+			data = append(data, s.Bytes()...)
+		}
+		return json.Unmarshal(data, summary)
+	}); err != nil {
+		return nil, "", err
+	}
+
+	var format string
+	switch summary.OutputFormat {
+	case "DYNAMODB_JSON":
+		format = FormatDynamoJSON
+	case "ION":
+		format = FormatIon
+	default:
+		return nil, "", fmt.Errorf("unsupported export format %q in %s", summary.OutputFormat, key)
+	}
+
+	var files []string
+	if err := readExportObject(svc, bucket, summary.ManifestFilesS3Key, func(s *bufio.Scanner) error {
+		for s.Scan() {
+			if len(strings.TrimSpace(s.Text())) == 0 {
+				continue
+			}
+			var f exportFile
+			if err := json.Unmarshal(s.Bytes(), &f); err != nil {
+				return err
+			}
+			files = append(files, f.DataFileS3Key)
+		}
+		return nil
+	}); err != nil {
+		return nil, "", err
+	}
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no data files found in export %s", summary.ExportArn)
+	}
+
+	log.Printf("restoring export %s, %d items in %d files", summary.ExportArn, summary.ItemCount, len(files))
+	return files, format, nil
+}
+
+func readExportObject(svc s3iface.S3API, bucket, key string, read func(s *bufio.Scanner) error) error {
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	s := bufio.NewScanner(out.Body)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if err := read(s); err != nil {
+		return fmt.Errorf("error %s whilst reading %s", err, key)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("error %s whilst reading %s", err, key)
+	}
+	return nil
+}
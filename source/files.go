@@ -0,0 +1,157 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/SEEK-Jobs/dynamotools/manifest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Files works out the archive files of a source in the bucket, which is either an archive manifest, a prefix
+// ending in / with the archive files under it or a single archive file.
+func Files(svc s3iface.S3API, bucket, src string) ([]string, error) {
+	switch {
+	case manifest.IsManifest(src):
+		m, err := manifest.Read(svc, bucket, src)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, len(m.Parts))
+		for i, p := range m.Parts {
+			keys[i] = p.Key
+		}
+		return keys, nil
+	case strings.HasSuffix(src, "/"):
+		return ListParts(svc, bucket, src)
+	}
+	return []string{src}, nil
+}
+
+// ParseURI splits an s3://bucket/key uri, anything else is a key in the default bucket
+func ParseURI(uri, bucket string) (string, string) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return bucket, uri
+	}
+	path := strings.TrimPrefix(uri, "s3://")
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// ListParts returns the keys of the archive files under the prefix, leaving out any manifests
+func ListParts(svc s3iface.S3API, bucket, prefix string) ([]string, error) {
+	var keys []string
+	err := svc.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(p *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, o := range p.Contents {
+			k := aws.StringValue(o.Key)
+			if !strings.HasSuffix(k, "/") && !manifest.IsManifest(k) {
+				keys = append(keys, k)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no archive files found under %s", prefix)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Download copies the archive file to a local temporary file, the caller removes it once done
+func Download(s *session.Session, bucket, key string) (*os.File, error) {
+	file, err := ioutil.TempFile("", "dynamotools-")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("downloading %s ....", key)
+	_, err = s3manager.NewDownloader(s).Download(file, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// Each downloads the archive file and calls fn with every chunk of items decoded from it
+func Each(s *session.Session, bucket, key string, columns *CSVMapping, fn func(items []map[string]interface{}) error) error {
+	file, err := Download(s, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	dec, err := Open(file, keyFormat(key), 0, columns)
+	if err != nil {
+		return fmt.Errorf("error %s whilst opening %s", err, key)
+	}
+	return decodeAll(dec, key, fn)
+}
+
+// ErrStop can be returned by the function reading an archive to stop reading early, it is passed back to the
+// caller like any other error.
+var ErrStop = errors.New("stop reading")
+
+// Stream decodes the archive file as it is read from the bucket, calling fn with every chunk of items until
+// the end of the file or until fn returns an error.
+func Stream(svc s3iface.S3API, bucket, key string, columns *CSVMapping, fn func(items []map[string]interface{}) error) error {
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	dec, err := OpenReader(out.Body, keyFormat(key), columns)
+	if err != nil {
+		return fmt.Errorf("error %s whilst opening %s", err, key)
+	}
+	return decodeAll(dec, key, fn)
+}
+
+// keyFormat is the format of an archive file as far as its key tells, csv or else worked out from the file
+func keyFormat(key string) string {
+	if IsCSV(key) {
+		return FormatCSV
+	}
+	return FormatAuto
+}
+
+func decodeAll(dec Decoder, key string, fn func(items []map[string]interface{}) error) error {
+	for {
+		items, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error %s whilst decoding %s", err, key)
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+	}
+}
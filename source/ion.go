@@ -0,0 +1,552 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ionDecoder reads the Amazon Ion text written by the AWS managed export. It only understands the subset of
+// Ion the export uses: structs, lists, strings, symbols, decimals, blobs, bools, nulls and the $dynamodb_SS,
+// $dynamodb_NS and $dynamodb_BS annotations which mark sets.
+type ionDecoder struct {
+	r     *bufio.Reader
+	start int64
+	pos   int64
+}
+
+func newIonDecoder(r *bufio.Reader, start int64) *ionDecoder {
+	return &ionDecoder{r: r, start: start}
+}
+
+func (d *ionDecoder) Offset() int64 {
+	return d.start + d.pos
+}
+
+func (d *ionDecoder) Next() ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	for len(items) < linesChunk {
+		av, err := d.topLevel()
+		if err == io.EOF && len(items) != 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if av.M == nil || av.M["Item"] == nil || av.M["Item"].M == nil {
+			return nil, fmt.Errorf("expected an {Item: {...}} struct at offset %d", d.Offset())
+		}
+		item, err := ItemFromAttributes(av.M["Item"].M)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// topLevel returns the next top level value, skipping the $ion_1_0 version markers
+func (d *ionDecoder) topLevel() (*dynamodb.AttributeValue, error) {
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, err
+		}
+		c, err := d.peek()
+		if err != nil {
+			return nil, err
+		}
+		if c == '$' {
+			b, _ := d.r.Peek(8)
+			if string(b) == "$ion_1_0" {
+				d.discard(8)
+				continue
+			}
+		}
+		return d.value()
+	}
+}
+
+func (d *ionDecoder) value() (*dynamodb.AttributeValue, error) {
+	var annotations []string
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, d.unexpected(err)
+		}
+		c, err := d.peek()
+		if err != nil {
+			return nil, d.unexpected(err)
+		}
+
+		var av *dynamodb.AttributeValue
+		switch {
+		case c == '{':
+			av, err = d.structOrBlob()
+		case c == '[':
+			av, err = d.list()
+		case c == '"':
+			var s string
+			if s, err = d.quoted('"'); err == nil {
+				av = &dynamodb.AttributeValue{S: aws.String(s)}
+			}
+		case c == '\'':
+			var s string
+			var long bool
+			if s, long, err = d.quotedSymbol(); err != nil {
+				return nil, err
+			}
+			if !long {
+				if ok, err := d.annotation(); err != nil {
+					return nil, err
+				} else if ok {
+					annotations = append(annotations, s)
+					continue
+				}
+			}
+			av = &dynamodb.AttributeValue{S: aws.String(s)}
+		case c == '-' || c == '+' || (c >= '0' && c <= '9'):
+			av, err = d.number()
+		case isIdentStart(c):
+			sym := d.identifier()
+			if ok, err := d.annotation(); err != nil {
+				return nil, err
+			} else if ok {
+				annotations = append(annotations, sym)
+				continue
+			}
+			av, err = symbolValue(sym)
+		default:
+			err = fmt.Errorf("unsupported ion value starting with %q at offset %d", c, d.Offset())
+		}
+		if err != nil {
+			return nil, err
+		}
+		return annotate(av, annotations)
+	}
+}
+
+func (d *ionDecoder) structOrBlob() (*dynamodb.AttributeValue, error) {
+	d.discard(1)
+	if c, err := d.peek(); err == nil && c == '{' {
+		d.discard(1)
+		return d.blob()
+	}
+
+	m := map[string]*dynamodb.AttributeValue{}
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, d.unexpected(err)
+		}
+		c, err := d.peek()
+		if err != nil {
+			return nil, d.unexpected(err)
+		}
+		if c == '}' {
+			d.discard(1)
+			return &dynamodb.AttributeValue{M: m}, nil
+		}
+
+		var name string
+		switch {
+		case c == '"':
+			name, err = d.quoted('"')
+		case c == '\'':
+			name, _, err = d.quotedSymbol()
+		case isIdentStart(c):
+			name = d.identifier()
+		default:
+			err = fmt.Errorf("unexpected %q in struct at offset %d", c, d.Offset())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := d.expect(':'); err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+		if err := d.separator('}'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *ionDecoder) list() (*dynamodb.AttributeValue, error) {
+	d.discard(1)
+	l := []*dynamodb.AttributeValue{}
+	for {
+		if err := d.skipSpace(); err != nil {
+			return nil, d.unexpected(err)
+		}
+		c, err := d.peek()
+		if err != nil {
+			return nil, d.unexpected(err)
+		}
+		if c == ']' {
+			d.discard(1)
+			return &dynamodb.AttributeValue{L: l}, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+		if err := d.separator(']'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// blob reads the base64 up to the closing }}
+func (d *ionDecoder) blob() (*dynamodb.AttributeValue, error) {
+	var buf bytes.Buffer
+	for {
+		c, err := d.read()
+		if err != nil {
+			return nil, d.unexpected(err)
+		}
+		if c == '}' {
+			if err := d.expect('}'); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			buf.WriteByte(c)
+		}
+	}
+	b, err := base64.StdEncoding.DecodeString(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob at offset %d: %v", d.Offset(), err)
+	}
+	return &dynamodb.AttributeValue{B: b}, nil
+}
+
+func (d *ionDecoder) number() (*dynamodb.AttributeValue, error) {
+	var buf bytes.Buffer
+	for {
+		c, err := d.peek()
+		if err != nil || !(isIdentChar(c) || c == '.' || c == '-' || c == '+') {
+			break
+		}
+		d.discard(1)
+		if c != '_' {
+			buf.WriteByte(c)
+		}
+	}
+	n := strings.Replace(strings.Replace(buf.String(), "d", "e", 1), "D", "e", 1)
+	n = strings.TrimPrefix(n, "+")
+	if strings.HasSuffix(n, ".") {
+		n = strings.TrimSuffix(n, ".")
+	}
+	if _, err := strconv.ParseFloat(n, 64); err != nil {
+		return nil, fmt.Errorf("unsupported ion number %q at offset %d", buf.String(), d.Offset())
+	}
+	return &dynamodb.AttributeValue{N: aws.String(n)}, nil
+}
+
+// quotedSymbol reads a quoted symbol or a triple quoted long string, concatenating adjacent long string segments
+func (d *ionDecoder) quotedSymbol() (string, bool, error) {
+	if b, _ := d.r.Peek(3); string(b) != "'''" {
+		s, err := d.quoted('\'')
+		return s, false, err
+	}
+
+	var sb strings.Builder
+	for {
+		d.discard(3)
+		for {
+			if b, _ := d.r.Peek(3); string(b) == "'''" {
+				d.discard(3)
+				break
+			}
+			r, err := d.char()
+			if err != nil {
+				return "", true, err
+			}
+			sb.WriteString(r)
+		}
+		if err := d.skipSpace(); err != nil && err != io.EOF {
+			return "", true, err
+		}
+		if b, _ := d.r.Peek(3); string(b) != "'''" {
+			return sb.String(), true, nil
+		}
+	}
+}
+
+// quoted reads a string up to the closing quote, unescaping it
+func (d *ionDecoder) quoted(quote byte) (string, error) {
+	d.discard(1)
+	var sb strings.Builder
+	for {
+		c, err := d.peek()
+		if err != nil {
+			return "", d.unexpected(err)
+		}
+		if c == quote {
+			d.discard(1)
+			return sb.String(), nil
+		}
+		s, err := d.char()
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s)
+	}
+}
+
+// char reads a single, possibly escaped, character of a string
+func (d *ionDecoder) char() (string, error) {
+	c, err := d.read()
+	if err != nil {
+		return "", d.unexpected(err)
+	}
+	if c != '\\' {
+		return string(c), nil
+	}
+
+	e, err := d.read()
+	if err != nil {
+		return "", d.unexpected(err)
+	}
+	switch e {
+	case 'n':
+		return "\n", nil
+	case 't':
+		return "\t", nil
+	case 'r':
+		return "\r", nil
+	case '0':
+		return "\x00", nil
+	case 'a':
+		return "\a", nil
+	case 'b':
+		return "\b", nil
+	case 'f':
+		return "\f", nil
+	case 'v':
+		return "\v", nil
+	case '\n':
+		return "", nil
+	case 'x':
+		return d.hexRune(2)
+	case 'u':
+		return d.hexRune(4)
+	case 'U':
+		return d.hexRune(8)
+	}
+	return string(e), nil
+}
+
+func (d *ionDecoder) hexRune(digits int) (string, error) {
+	b := make([]byte, digits)
+	for i := range b {
+		c, err := d.read()
+		if err != nil {
+			return "", d.unexpected(err)
+		}
+		b[i] = c
+	}
+	n, err := strconv.ParseUint(string(b), 16, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid escape at offset %d", d.Offset())
+	}
+	if digits == 2 {
+		return string([]byte{byte(n)}), nil
+	}
+	r := rune(n)
+	// surrogate pairs are written as two \u escapes.
+	if r >= 0xd800 && r < 0xdc00 {
+		if b, _ := d.r.Peek(2); string(b) == "\\u" {
+			d.discard(2)
+			low, err := d.hexRune(4)
+			if err != nil {
+				return "", err
+			}
+			lr, _ := utf8.DecodeRuneInString(low)
+			r = (r-0xd800)<<10 + (lr - 0xdc00) + 0x10000
+		}
+	}
+	return string(r), nil
+}
+
+func (d *ionDecoder) identifier() string {
+	var buf bytes.Buffer
+	for {
+		c, err := d.peek()
+		if err != nil || !(isIdentChar(c) || c == '.') {
+			return buf.String()
+		}
+		d.discard(1)
+		buf.WriteByte(c)
+	}
+}
+
+// annotation reports whether the symbol just read is followed by :: and so annotates the next value
+func (d *ionDecoder) annotation() (bool, error) {
+	if err := d.skipSpace(); err != nil && err != io.EOF {
+		return false, err
+	}
+	if b, _ := d.r.Peek(2); string(b) == "::" {
+		d.discard(2)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (d *ionDecoder) separator(end byte) error {
+	if err := d.skipSpace(); err != nil {
+		return d.unexpected(err)
+	}
+	c, err := d.peek()
+	if err != nil {
+		return d.unexpected(err)
+	}
+	if c == ',' {
+		d.discard(1)
+		return nil
+	}
+	if c != end {
+		return fmt.Errorf("expected , or %q at offset %d but found %q", end, d.Offset(), c)
+	}
+	return nil
+}
+
+func (d *ionDecoder) expect(want byte) error {
+	if err := d.skipSpace(); err != nil {
+		return d.unexpected(err)
+	}
+	c, err := d.read()
+	if err != nil {
+		return d.unexpected(err)
+	}
+	if c != want {
+		return fmt.Errorf("expected %q at offset %d but found %q", want, d.Offset(), c)
+	}
+	return nil
+}
+
+// skipSpace skips whitespace and comments
+func (d *ionDecoder) skipSpace() error {
+	for {
+		c, err := d.peek()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			d.discard(1)
+			continue
+		case '/':
+			b, _ := d.r.Peek(2)
+			if string(b) == "//" {
+				for c != '\n' {
+					if c, err = d.read(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if string(b) == "/*" {
+				d.discard(2)
+				for {
+					if b, _ := d.r.Peek(2); string(b) == "*/" {
+						d.discard(2)
+						break
+					}
+					if _, err := d.read(); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+		return nil
+	}
+}
+
+func (d *ionDecoder) peek() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *ionDecoder) read() (byte, error) {
+	c, err := d.r.ReadByte()
+	if err == nil {
+		d.pos++
+	}
+	return c, err
+}
+
+func (d *ionDecoder) discard(n int) {
+	m, _ := d.r.Discard(n)
+	d.pos += int64(m)
+}
+
+func (d *ionDecoder) unexpected(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("unexpected end of ion data at offset %d", d.Offset())
+	}
+	return err
+}
+
+func isIdentStart(c byte) bool {
+	return c == '$' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func symbolValue(sym string) (*dynamodb.AttributeValue, error) {
+	switch {
+	case sym == "true" || sym == "false":
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(sym == "true")}, nil
+	case sym == "null" || strings.HasPrefix(sym, "null."):
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
+	case sym == "nan":
+		return nil, fmt.Errorf("nan can not be restored to dynamo")
+	}
+	return &dynamodb.AttributeValue{S: aws.String(sym)}, nil
+}
+
+// annotate turns the lists annotated as sets by the export into dynamo sets
+func annotate(av *dynamodb.AttributeValue, annotations []string) (*dynamodb.AttributeValue, error) {
+	for _, a := range annotations {
+		if a != "$dynamodb_SS" && a != "$dynamodb_NS" && a != "$dynamodb_BS" {
+			continue
+		}
+		if av.L == nil {
+			return nil, fmt.Errorf("%s annotates a value which is not a list", a)
+		}
+		set := &dynamodb.AttributeValue{}
+		for _, e := range av.L {
+			switch {
+			case a == "$dynamodb_SS" && e.S != nil:
+				set.SS = append(set.SS, e.S)
+			case a == "$dynamodb_NS" && e.N != nil:
+				set.NS = append(set.NS, e.N)
+			case a == "$dynamodb_BS" && e.B != nil:
+				set.BS = append(set.BS, e.B)
+			default:
+				return nil, fmt.Errorf("unexpected member in %s set", a)
+			}
+		}
+		return set, nil
+	}
+	return av, nil
+}
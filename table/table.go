@@ -0,0 +1,88 @@
+package table
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// KeySchema returns the key attributes of the table, the hash key first
+func KeySchema(db dynamodbiface.DynamoDBAPI, table string) ([]string, error) {
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, err
+	}
+	var hash, rng []string
+	for _, k := range out.Table.KeySchema {
+		if aws.StringValue(k.KeyType) == dynamodb.KeyTypeHash {
+			hash = append(hash, aws.StringValue(k.AttributeName))
+		} else {
+			rng = append(rng, aws.StringValue(k.AttributeName))
+		}
+	}
+	if len(hash) == 0 {
+		return nil, fmt.Errorf("no hash key found for table %s", table)
+	}
+	return append(hash, rng...), nil
+}
+
+// KeyTypes returns the scalar type of each key attribute of the table
+func KeyTypes(db dynamodbiface.DynamoDBAPI, table string) (map[string]string, error) {
+	out, err := db.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err != nil {
+		return nil, err
+	}
+	defs := map[string]string{}
+	for _, d := range out.Table.AttributeDefinitions {
+		defs[aws.StringValue(d.AttributeName)] = aws.StringValue(d.AttributeType)
+	}
+	types := map[string]string{}
+	for _, k := range out.Table.KeySchema {
+		name := aws.StringValue(k.AttributeName)
+		types[name] = defs[name]
+	}
+	return types, nil
+}
+
+// KeyID builds a string identifying the item by its key attributes, numbers and strings with the
+// same text are treated as equal because csv keys are untyped.
+func KeyID(item map[string]interface{}, keyAttrs []string) (string, bool) {
+	parts := make([]string, len(keyAttrs))
+	for i, a := range keyAttrs {
+		switch v := item[a].(type) {
+		case string:
+			parts[i] = v
+		case float64:
+			parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case dynamodbattribute.Number:
+			parts[i] = string(v)
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// Key returns just the key attributes of the item
+func Key(item map[string]interface{}, keyAttrs []string) map[string]interface{} {
+	key := make(map[string]interface{}, len(keyAttrs))
+	for _, a := range keyAttrs {
+		key[a] = item[a]
+	}
+	return key
+}
+
+// KeyAttributes returns just the key attributes of the item as dynamo returned them, so the key is sent back
+// exactly as it was read
+func KeyAttributes(attrs map[string]*dynamodb.AttributeValue, keyAttrs []string) map[string]*dynamodb.AttributeValue {
+	key := make(map[string]*dynamodb.AttributeValue, len(keyAttrs))
+	for _, a := range keyAttrs {
+		key[a] = attrs[a]
+	}
+	return key
+}
@@ -0,0 +1,194 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// number is a dynamodb number, kept as its digits when coerced from a string so long ids are not rounded
+var number = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+// Step is a single transform applied to an item, as read from the transforms file
+type Step struct {
+	Op         string      `json:"op"`
+	From       string      `json:"from,omitempty"`
+	To         string      `json:"to,omitempty"`
+	Attributes []string    `json:"attributes,omitempty"`
+	Value      interface{} `json:"value,omitempty"`
+	Separator  string      `json:"separator,omitempty"`
+	Type       string      `json:"type,omitempty"`
+}
+
+// Transformer applies a list of transform steps to items in order
+type Transformer struct {
+	steps []Step
+}
+
+// New validates the steps and creates a transformer for them
+func New(steps []Step) (*Transformer, error) {
+	for i, s := range steps {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("transform %d: %v", i, err)
+		}
+	}
+	return &Transformer{steps: steps}, nil
+}
+
+// Load reads a json array of transform steps from the file
+func Load(path string) (*Transformer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var steps []Step
+	if err := json.NewDecoder(f).Decode(&steps); err != nil {
+		return nil, fmt.Errorf("error %s whilst reading transforms from %s", err, path)
+	}
+	return New(steps)
+}
+
+// Apply runs every step against the item, which is modified in place and returned.
+// A nil transformer returns the item untouched.
+func (t *Transformer) Apply(item map[string]interface{}) (map[string]interface{}, error) {
+	if t == nil {
+		return item, nil
+	}
+	for _, s := range t.steps {
+		if err := s.apply(item); err != nil {
+			return nil, err
+		}
+	}
+	return item, nil
+}
+
+func (s Step) validate() error {
+	switch s.Op {
+	case "rename", "copy":
+		if s.From == "" || s.To == "" {
+			return fmt.Errorf("%s needs from and to", s.Op)
+		}
+	case "drop":
+		if len(s.Attributes) == 0 {
+			return fmt.Errorf("drop needs attributes")
+		}
+	case "set":
+		if s.To == "" || s.Value == nil {
+			return fmt.Errorf("set needs to and value")
+		}
+	case "concat":
+		if len(s.Attributes) == 0 || s.To == "" {
+			return fmt.Errorf("concat needs attributes and to")
+		}
+	case "coerce":
+		if len(s.Attributes) == 0 {
+			return fmt.Errorf("coerce needs attributes")
+		}
+		if s.Type != "string" && s.Type != "number" && s.Type != "bool" {
+			return fmt.Errorf("invalid coerce type %q (string|number|bool)", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", s.Op)
+	}
+	return nil
+}
+
+func (s Step) apply(item map[string]interface{}) error {
+	switch s.Op {
+	case "rename":
+		if v, ok := item[s.From]; ok {
+			delete(item, s.From)
+			item[s.To] = v
+		}
+	case "copy":
+		if v, ok := item[s.From]; ok {
+			item[s.To] = v
+		}
+	case "drop":
+		for _, a := range s.Attributes {
+			delete(item, a)
+		}
+	case "set":
+		item[s.To] = s.Value
+	case "concat":
+		parts := make([]string, len(s.Attributes))
+		for i, a := range s.Attributes {
+			v, ok := item[a]
+			if !ok {
+				return fmt.Errorf("missing attribute %s for concat into %s", a, s.To)
+			}
+			str, err := toString(v)
+			if err != nil {
+				return err
+			}
+			parts[i] = str
+		}
+		item[s.To] = strings.Join(parts, s.Separator)
+	case "coerce":
+		for _, a := range s.Attributes {
+			v, ok := item[a]
+			if !ok {
+				continue
+			}
+			c, err := coerce(v, s.Type)
+			if err != nil {
+				return fmt.Errorf("error %s whilst coercing %s", err, a)
+			}
+			item[a] = c
+		}
+	}
+	return nil
+}
+
+func coerce(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return toString(v)
+	case "number":
+		switch n := v.(type) {
+		case float64, dynamodbattribute.Number:
+			return n, nil
+		case string:
+			if !number.MatchString(n) {
+				return nil, fmt.Errorf("%q is not a number", n)
+			}
+			return dynamodbattribute.Number(n), nil
+		case bool:
+			if n {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+	case "bool":
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			return strconv.ParseBool(b)
+		case float64:
+			return b != 0, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot coerce %T to %s", v, typ)
+}
+
+func toString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), nil
+	case dynamodbattribute.Number:
+		return string(s), nil
+	case bool:
+		return strconv.FormatBool(s), nil
+	}
+	return "", fmt.Errorf("cannot convert %T to a string", v)
+}
@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []Step
+		item    map[string]interface{}
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{"rename", []Step{{Op: "rename", From: "a", To: "b"}},
+			map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": 1.0}, false},
+		{"rename missing", []Step{{Op: "rename", From: "a", To: "b"}},
+			map[string]interface{}{"c": 1.0}, map[string]interface{}{"c": 1.0}, false},
+		{"copy", []Step{{Op: "copy", From: "a", To: "b"}},
+			map[string]interface{}{"a": "x"}, map[string]interface{}{"a": "x", "b": "x"}, false},
+		{"drop", []Step{{Op: "drop", Attributes: []string{"a", "missing"}}},
+			map[string]interface{}{"a": 1.0, "b": 2.0}, map[string]interface{}{"b": 2.0}, false},
+		{"set", []Step{{Op: "set", To: "status", Value: "open"}},
+			map[string]interface{}{"status": "closed"}, map[string]interface{}{"status": "open"}, false},
+		{"concat", []Step{{Op: "concat", Attributes: []string{"a", "n", "b"}, To: "c", Separator: "-"}},
+			map[string]interface{}{"a": "x", "n": 2.5, "b": true}, map[string]interface{}{"a": "x", "n": 2.5, "b": true, "c": "x-2.5-true"}, false},
+		{"concat missing", []Step{{Op: "concat", Attributes: []string{"a", "b"}, To: "c"}},
+			map[string]interface{}{"a": "x"}, nil, true},
+		{"steps in order", []Step{{Op: "rename", From: "a", To: "b"}, {Op: "coerce", Attributes: []string{"b"}, Type: "string"}},
+			map[string]interface{}{"a": 3.0}, map[string]interface{}{"b": "3"}, false},
+		{"coerce long number", []Step{{Op: "coerce", Attributes: []string{"id"}, Type: "number"}},
+			map[string]interface{}{"id": "12345678901234567"}, map[string]interface{}{"id": dynamodbattribute.Number("12345678901234567")}, false},
+		{"coerce decimal", []Step{{Op: "coerce", Attributes: []string{"n"}, Type: "number"}},
+			map[string]interface{}{"n": "-1.5e3"}, map[string]interface{}{"n": dynamodbattribute.Number("-1.5e3")}, false},
+		{"coerce not a number", []Step{{Op: "coerce", Attributes: []string{"n"}, Type: "number"}},
+			map[string]interface{}{"n": "12abc"}, nil, true},
+		{"coerce nan", []Step{{Op: "coerce", Attributes: []string{"n"}, Type: "number"}},
+			map[string]interface{}{"n": "NaN"}, nil, true},
+		{"coerce bool to number", []Step{{Op: "coerce", Attributes: []string{"n"}, Type: "number"}},
+			map[string]interface{}{"n": true}, map[string]interface{}{"n": 1.0}, false},
+		{"coerce number to string", []Step{{Op: "coerce", Attributes: []string{"n", "big"}, Type: "string"}},
+			map[string]interface{}{"n": 0.5, "big": dynamodbattribute.Number("12345678901234567")}, map[string]interface{}{"n": "0.5", "big": "12345678901234567"}, false},
+		{"coerce to bool", []Step{{Op: "coerce", Attributes: []string{"a", "b", "missing"}, Type: "bool"}},
+			map[string]interface{}{"a": "true", "b": 0.0}, map[string]interface{}{"a": true, "b": false}, false},
+		{"coerce invalid bool", []Step{{Op: "coerce", Attributes: []string{"a"}, Type: "bool"}},
+			map[string]interface{}{"a": "maybe"}, nil, true},
+		{"coerce list", []Step{{Op: "coerce", Attributes: []string{"a"}, Type: "string"}},
+			map[string]interface{}{"a": []interface{}{"x"}}, nil, true},
+	}
+	for _, tt := range tests {
+		tr, err := New(tt.steps)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		got, err := tr.Apply(tt.item)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		step Step
+	}{
+		{"unknown op", Step{Op: "upper"}},
+		{"rename without to", Step{Op: "rename", From: "a"}},
+		{"copy without from", Step{Op: "copy", To: "a"}},
+		{"drop without attributes", Step{Op: "drop"}},
+		{"set without value", Step{Op: "set", To: "a"}},
+		{"concat without to", Step{Op: "concat", Attributes: []string{"a"}}},
+		{"coerce without attributes", Step{Op: "coerce", Type: "number"}},
+		{"coerce to a list", Step{Op: "coerce", Attributes: []string{"a"}, Type: "list"}},
+	}
+	for _, tt := range tests {
+		if _, err := New([]Step{tt.step}); err == nil {
+			t.Errorf("%s: accepted %+v", tt.name, tt.step)
+		}
+	}
+}
+
+func TestNilTransformer(t *testing.T) {
+	var tr *Transformer
+	item := map[string]interface{}{"a": 1.0}
+	if got, err := tr.Apply(item); err != nil || !reflect.DeepEqual(got, item) {
+		t.Errorf("nil transformer returned %v, %v", got, err)
+	}
+}
@@ -0,0 +1,36 @@
+package update
+
+import "sync"
+
+// pool runs a function for items with a limited number at a time, the limit is shared by every segment
+type pool struct {
+	sem chan struct{}
+}
+
+// newPool creates a pool running up to n functions at once
+func newPool(n int) *pool {
+	if n < 1 {
+		n = 1
+	}
+	return &pool{sem: make(chan struct{}, n)}
+}
+
+// each calls fn with the index of every one of n items and waits for them all, returning the first error
+func (p *pool) each(n int, fn func(i int) error) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	for i := 0; i < n; i++ {
+		i := i
+		p.sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-p.sem; wg.Done() }()
+			if err := fn(i); err != nil {
+				once.Do(func() { first = err })
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
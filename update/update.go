@@ -0,0 +1,327 @@
+package update
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/checkpoint"
+	"github.com/SEEK-Jobs/dynamotools/filter"
+	"github.com/SEEK-Jobs/dynamotools/ratelimit"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const (
+	conditionalCheckFailed = "ConditionalCheckFailedException"
+	validationException    = "ValidationException"
+	// hashKeyName is the placeholder of the hash key in the condition that the item still exists
+	hashKeyName = "#updateHashKey"
+)
+
+var (
+	valuePlaceholder = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+	namePlaceholder  = regexp.MustCompile(`#[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// UpdateConfig provides the configuration for updating the matching items of a table
+type UpdateConfig struct {
+	Region         string
+	TableName      string
+	Where          string
+	Set            string
+	Condition      string
+	Values         string
+	KeyCondition   string
+	ScanPartitions int
+	ScanLimit      int
+	Workers        int
+	ReadCapacity   float64
+	WriteCapacity  float64
+	DryRun         bool
+	Resume         string
+	Upsert         bool
+}
+
+// counts of what happened to the matching items
+type counts struct {
+	updated int64
+	skipped int64
+	missing int64
+	failed  int64
+}
+
+// updater applies the update expression to an item at a time
+type updater struct {
+	db       dynamodbiface.DynamoDBAPI
+	c        *UpdateConfig
+	keyAttrs []string
+	names    map[string]*string
+	// condition is the condition expression sent with every update
+	condition string
+	// values are the static values used by the update and condition, fromItem the placeholders read from items
+	values    map[string]*dynamodb.AttributeValue
+	fromItem  []string
+	limiter   *ratelimit.Limiter
+	counts    counts
+	mu        sync.Mutex
+	dryRunOut *json.Encoder
+}
+
+// Items applies the update expression to every item matching the key condition and where filter. Values of
+// the expressions are taken from --values, or from the attribute of the item named like the placeholder.
+func Items(c *UpdateConfig) error {
+	f, err := filter.New(c.Where, "")
+	if err != nil {
+		return err
+	}
+	s := awssession.New(c.Region)
+	db := dynamodb.New(s)
+
+	static, err := parseValues(c.Values)
+	if err != nil {
+		return err
+	}
+	u := newUpdater(db, c, static)
+	keyNames, keyValues, err := keyPlaceholders(c.KeyCondition, static)
+	if err != nil {
+		return err
+	}
+	if c.ScanPartitions < 1 || c.KeyCondition != "" {
+		c.ScanPartitions = 1
+	}
+	keyAttrs, err := table.KeySchema(db, c.TableName)
+	if err != nil {
+		return err
+	}
+	u.setKey(keyAttrs)
+
+	var progress *checkpoint.Tracker
+	if c.DryRun {
+		u.dryRunOut = json.NewEncoder(os.Stdout)
+	} else {
+		var cp *checkpoint.Scan
+		if c.Resume != "" {
+			if cp, err = checkpoint.LoadScan("update", c.Resume, c.TableName, operation(c), c.ScanPartitions); err != nil {
+				return err
+			}
+			log.Printf("resuming run %s, %d items handled so far", cp.RunID, cp.Handled)
+		} else {
+			cp = checkpoint.NewScan("update", c.TableName, operation(c), c.ScanPartitions)
+			log.Printf("update run id %s", cp.RunID)
+		}
+		progress = checkpoint.NewTracker(cp)
+	}
+
+	scan := &archive.ScanConfig{
+		TableName:    c.TableName,
+		Segments:     c.ScanPartitions,
+		Limit:        c.ScanLimit,
+		KeyCondition: c.KeyCondition,
+		Names:        keyNames,
+		Values:       keyValues,
+		Filter:       f,
+		Limiter:      ratelimit.New(c.ReadCapacity),
+	}
+	if progress != nil {
+		scan.Progress = progress
+	}
+	workers := newPool(c.Workers)
+	if err := archive.ScanAttributes(db, scan, func(items []map[string]interface{}, attrs []map[string]*dynamodb.AttributeValue) error {
+		return workers.each(len(items), func(i int) error {
+			return u.update(items[i], attrs[i])
+		})
+	}); err != nil {
+		if progress != nil {
+			progress.Flush()
+			log.Printf("update failed, continue it with --resume %s", progress.RunID())
+		}
+		return err
+	}
+	if progress != nil {
+		progress.Remove()
+	}
+
+	verb := "updated"
+	if c.DryRun {
+		verb = "would update"
+	}
+	log.Printf("%s %d items of %s, %d were skipped by the condition or no longer existed, %d were missing an attribute for a placeholder, %d failed",
+		verb, u.counts.updated, c.TableName, u.counts.skipped, u.counts.missing, u.counts.failed)
+	return nil
+}
+
+// update applies the update to the item, keyed and valued by the attribute values dynamo returned for it. Items
+// which fail are counted and logged, only an expression which is rejected before any item has been updated stops
+// the run.
+func (u *updater) update(item map[string]interface{}, attrs map[string]*dynamodb.AttributeValue) error {
+	values := make(map[string]*dynamodb.AttributeValue, len(u.values)+len(u.fromItem))
+	for p, v := range u.values {
+		values[p] = v
+	}
+	for _, p := range u.fromItem {
+		av, ok := attrs[p[1:]]
+		if !ok {
+			atomic.AddInt64(&u.counts.missing, 1)
+			return nil
+		}
+		values[p] = av
+	}
+
+	if u.dryRunOut != nil {
+		shown, err := source.ItemFromAttributes(values)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		atomic.AddInt64(&u.counts.updated, 1)
+		return u.dryRunOut.Encode(map[string]interface{}{"key": table.Key(item, u.keyAttrs), "values": shown})
+	}
+
+	key := table.KeyAttributes(attrs, u.keyAttrs)
+	input := &dynamodb.UpdateItemInput{
+		TableName:              aws.String(u.c.TableName),
+		Key:                    key,
+		UpdateExpression:       aws.String(u.c.Set),
+		ReturnConsumedCapacity: aws.String(dynamodb.ReturnConsumedCapacityTotal),
+	}
+	if u.condition != "" {
+		input.ConditionExpression = aws.String(u.condition)
+	}
+	if len(u.names) != 0 {
+		input.ExpressionAttributeNames = u.names
+	}
+	if len(values) != 0 {
+		input.ExpressionAttributeValues = values
+	}
+
+	out, err := u.db.UpdateItem(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case conditionalCheckFailed:
+				atomic.AddInt64(&u.counts.skipped, 1)
+				return nil
+			case validationException:
+				// a malformed expression fails every item, so stop before any are updated.
+				if atomic.LoadInt64(&u.counts.updated) == 0 {
+					return err
+				}
+			}
+		}
+		log.Printf("error %s whilst updating item %v", err, key)
+		atomic.AddInt64(&u.counts.failed, 1)
+		return nil
+	}
+	if out.ConsumedCapacity != nil {
+		u.limiter.Wait(aws.Float64Value(out.ConsumedCapacity.CapacityUnits))
+	}
+	atomic.AddInt64(&u.counts.updated, 1)
+	return nil
+}
+
+// setKey sets the key attributes of the table. Unless the update upserts, the condition also requires the item to
+// still exist, so an item deleted since it was scanned is skipped rather than created with just the set attributes.
+func (u *updater) setKey(keyAttrs []string) {
+	u.keyAttrs = keyAttrs
+	u.condition = u.c.Condition
+	if u.c.Upsert {
+		return
+	}
+	u.names[hashKeyName] = aws.String(keyAttrs[0])
+	u.condition = fmt.Sprintf("attribute_exists(%s)", hashKeyName)
+	if u.c.Condition != "" {
+		u.condition += fmt.Sprintf(" AND (%s)", u.c.Condition)
+	}
+}
+
+// newUpdater takes the names and values of the update and condition expressions, the values from --values or else
+// from the attribute of each item named like the placeholder
+func newUpdater(db dynamodbiface.DynamoDBAPI, c *UpdateConfig, static map[string]*dynamodb.AttributeValue) *updater {
+	u := &updater{
+		db:      db,
+		c:       c,
+		names:   map[string]*string{},
+		values:  map[string]*dynamodb.AttributeValue{},
+		limiter: ratelimit.New(c.WriteCapacity),
+	}
+	for _, expr := range []string{c.Set, c.Condition} {
+		for _, name := range namePlaceholder.FindAllString(expr, -1) {
+			u.names[name] = aws.String(name[1:])
+		}
+		for _, p := range valuePlaceholder.FindAllString(expr, -1) {
+			if v, ok := static[p]; ok {
+				u.values[p] = v
+			} else if !contains(u.fromItem, p) {
+				u.fromItem = append(u.fromItem, p)
+			}
+		}
+	}
+	return u
+}
+
+// keyPlaceholders returns the names and values of the key condition, every value has to be in --values
+func keyPlaceholders(keyCondition string, static map[string]*dynamodb.AttributeValue) (map[string]*string, map[string]*dynamodb.AttributeValue, error) {
+	names, values := map[string]*string{}, map[string]*dynamodb.AttributeValue{}
+	for _, name := range namePlaceholder.FindAllString(keyCondition, -1) {
+		names[name] = aws.String(name[1:])
+	}
+	for _, p := range valuePlaceholder.FindAllString(keyCondition, -1) {
+		v, ok := static[p]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing value for %s of the key condition in --values", p)
+		}
+		values[p] = v
+	}
+	return names, values, nil
+}
+
+// operation describes every option which changes the items an update handles or what it does to them, a resumed
+// run has to have the same
+func operation(c *UpdateConfig) string {
+	return fmt.Sprintf("update %s condition %s values %s where %s key condition %s upsert %t", c.Set, c.Condition, c.Values, c.Where, c.KeyCondition, c.Upsert)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseValues reads the json object of static values, e.g. {":status": "open"}
+func parseValues(s string) (map[string]*dynamodb.AttributeValue, error) {
+	values := map[string]*dynamodb.AttributeValue{}
+	if s == "" {
+		return values, nil
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("invalid values %q: %v", s, err)
+	}
+	for p, v := range raw {
+		if valuePlaceholder.FindString(p) != p {
+			return nil, fmt.Errorf("invalid value placeholder %q, expected :name", p)
+		}
+		av, err := dynamodbattribute.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		values[p] = av
+	}
+	return values, nil
+}
@@ -0,0 +1,210 @@
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		values  string
+		want    map[string]*dynamodb.AttributeValue
+		wantErr bool
+	}{
+		{"", map[string]*dynamodb.AttributeValue{}, false},
+		{`{":status": "open", ":n": 2}`, map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String("open")},
+			":n":      {N: aws.String("2")},
+		}, false},
+		{`{"status": "open"}`, nil, true},
+		{`{":a-b": 1}`, nil, true},
+		{`[":status"]`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseValues(tt.values)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.values, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: values %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestNewUpdater(t *testing.T) {
+	static := map[string]*dynamodb.AttributeValue{":status": {S: aws.String("closed")}}
+	tests := []struct {
+		name         string
+		set          string
+		condition    string
+		wantNames    []string
+		wantStatic   []string
+		wantFromItem []string
+	}{
+		{"static", "SET #status = :status", "", []string{"#status"}, []string{":status"}, nil},
+		{"from item", "SET #fullName = :firstName", "attribute_not_exists(#fullName)", []string{"#fullName"}, nil, []string{":firstName"}},
+		{"repeated", "SET a = :x, b = :x, #s = :status", "c <> :x", []string{"#s"}, []string{":status"}, []string{":x"}},
+	}
+	for _, tt := range tests {
+		u := newUpdater(nil, &UpdateConfig{Set: tt.set, Condition: tt.condition}, static)
+		var names, values []string
+		for n, v := range u.names {
+			if *v != n[1:] {
+				t.Errorf("%s: %s names %s", tt.name, n, *v)
+			}
+			names = append(names, n)
+		}
+		for p := range u.values {
+			values = append(values, p)
+		}
+		sort.Strings(names)
+		sort.Strings(values)
+		if !reflect.DeepEqual(names, tt.wantNames) || !reflect.DeepEqual(values, tt.wantStatic) || !reflect.DeepEqual(u.fromItem, tt.wantFromItem) {
+			t.Errorf("%s: names %v static %v from item %v, want %v %v %v", tt.name, names, values, u.fromItem, tt.wantNames, tt.wantStatic, tt.wantFromItem)
+		}
+	}
+}
+
+func TestKeyPlaceholders(t *testing.T) {
+	static := map[string]*dynamodb.AttributeValue{":id": {S: aws.String("42")}}
+	names, values, err := keyPlaceholders("#advertiser = :id", static)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || *names["#advertiser"] != "advertiser" || values[":id"] != static[":id"] {
+		t.Errorf("names %v values %v", names, values)
+	}
+	if _, _, err := keyPlaceholders("#advertiser = :other", static); err == nil {
+		t.Errorf("a key condition placeholder missing from the values was accepted")
+	}
+}
+
+func TestUpdateDryRun(t *testing.T) {
+	static := map[string]*dynamodb.AttributeValue{":status": {S: aws.String("closed")}}
+	u := newUpdater(nil, &UpdateConfig{Set: "SET #status = :status, fullName = :firstName"}, static)
+	u.keyAttrs = []string{"id"}
+	var buf bytes.Buffer
+	u.dryRunOut = json.NewEncoder(&buf)
+
+	items := []map[string]*dynamodb.AttributeValue{
+		{"id": {S: aws.String("a")}, "firstName": {S: aws.String("Ann")}},
+		{"id": {S: aws.String("b")}},
+	}
+	for _, attrs := range items {
+		item, err := source.ItemFromAttributes(attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := u.update(item, attrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{"key":{"id":"a"},"values":{":firstName":"Ann",":status":"closed"}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("printed %q, want %q", buf.String(), want)
+	}
+	if u.counts.updated != 1 || u.counts.missing != 1 {
+		t.Errorf("%d updated and %d missing, want 1 and 1", u.counts.updated, u.counts.missing)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	base := UpdateConfig{Set: "SET a = :a", Values: `{":a": 1}`}
+	changed := []UpdateConfig{base, base, base, base, base, base}
+	changed[0].Set = "SET a = :b"
+	changed[1].Condition = "attribute_exists(a)"
+	changed[2].Values = `{":a": 2}`
+	changed[3].Where = "b == 'x'"
+	changed[4].KeyCondition = "id = :a"
+	changed[5].Upsert = true
+	for _, c := range changed {
+		c := c
+		if operation(&c) == operation(&base) {
+			t.Errorf("%+v has the same operation as %+v", c, base)
+		}
+	}
+	other := base
+	other.ScanLimit, other.Workers = 10, 4
+	if operation(&other) != operation(&base) {
+		t.Errorf("the scan limit and workers changed the operation")
+	}
+}
+
+// fakeTable records the updates sent to it and fails the ones for keys in conditionFails
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	updates        []*dynamodb.UpdateItemInput
+	conditionFails map[string]bool
+}
+
+func (ft *fakeTable) UpdateItem(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	ft.updates = append(ft.updates, in)
+	if ft.conditionFails[aws.StringValue(in.Key["id"].N)] {
+		return nil, awserr.New(conditionalCheckFailed, "the conditional request failed", nil)
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name          string
+		condition     string
+		upsert        bool
+		wantCondition string
+	}{
+		{"exists", "", false, "attribute_exists(#updateHashKey)"},
+		{"exists and condition", "attribute_not_exists(#s) OR #s = :status", false, "attribute_exists(#updateHashKey) AND (attribute_not_exists(#s) OR #s = :status)"},
+		{"upsert", "", true, ""},
+		{"upsert and condition", "#s = :status", true, "#s = :status"},
+	}
+	static := map[string]*dynamodb.AttributeValue{":status": {S: aws.String("closed")}}
+	for _, tt := range tests {
+		db := &fakeTable{conditionFails: map[string]bool{"2": true}}
+		c := &UpdateConfig{TableName: "jobs", Set: "SET #s = :status, n = :n", Condition: tt.condition, Upsert: tt.upsert}
+		u := newUpdater(db, c, static)
+		u.setKey([]string{"id", "sort"})
+
+		items := []map[string]*dynamodb.AttributeValue{
+			{"id": {N: aws.String("12345678901234567")}, "sort": {S: aws.String("x")}, "n": {N: aws.String("98765432109876543")}},
+			{"id": {N: aws.String("2")}, "sort": {S: aws.String("y")}, "n": {N: aws.String("1")}},
+		}
+		for _, attrs := range items {
+			item, err := source.ItemFromAttributes(attrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := u.update(item, attrs); err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+		}
+		if len(db.updates) != 2 {
+			t.Fatalf("%s: sent %d updates, want 2", tt.name, len(db.updates))
+		}
+		in := db.updates[0]
+		if !reflect.DeepEqual(in.Key, map[string]*dynamodb.AttributeValue{"id": items[0]["id"], "sort": items[0]["sort"]}) {
+			t.Errorf("%s: key %v, want the key attributes as read", tt.name, in.Key)
+		}
+		if aws.StringValue(in.ExpressionAttributeValues[":n"].N) != "98765432109876543" {
+			t.Errorf("%s: value %v, want the attribute as read", tt.name, in.ExpressionAttributeValues[":n"])
+		}
+		if aws.StringValue(in.ConditionExpression) != tt.wantCondition {
+			t.Errorf("%s: condition %q, want %q", tt.name, aws.StringValue(in.ConditionExpression), tt.wantCondition)
+		}
+		if hash, ok := in.ExpressionAttributeNames[hashKeyName]; ok == tt.upsert || (ok && aws.StringValue(hash) != "id") {
+			t.Errorf("%s: names %v", tt.name, in.ExpressionAttributeNames)
+		}
+		if u.counts.updated != 1 || u.counts.skipped != 1 || u.counts.failed != 0 {
+			t.Errorf("%s: %d updated, %d skipped and %d failed, want 1, 1 and 0", tt.name, u.counts.updated, u.counts.skipped, u.counts.failed)
+		}
+	}
+}
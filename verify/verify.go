@@ -0,0 +1,257 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/SEEK-Jobs/dynamotools/archive"
+	"github.com/SEEK-Jobs/dynamotools/awssession"
+	"github.com/SEEK-Jobs/dynamotools/extsort"
+	"github.com/SEEK-Jobs/dynamotools/source"
+	"github.com/SEEK-Jobs/dynamotools/table"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrMismatch is returned when the archive and the table do not hold the same items
+var ErrMismatch = errors.New("archive and table differ")
+
+// report statuses
+const (
+	MissingFromTable   = "missing-from-table"
+	MissingFromArchive = "missing-from-archive"
+	Different          = "different"
+)
+
+// VerifyConfig provides the configuration for comparing an archive with a live table
+type VerifyConfig struct {
+	Region         string
+	TableName      string
+	Bucket         string
+	Source         string
+	ScanPartitions int
+	ScanLimit      int
+	Readers        int
+	ReportFile     string
+	SortItems      int
+	TempDir        string
+}
+
+// entry is what is kept of every item, its key for the report and a hash of its content
+type entry struct {
+	Key  map[string]interface{} `json:"key"`
+	Hash []byte                 `json:"hash"`
+}
+
+// itemSet collects the entries of one side of the comparison, sorted by key on disk
+type itemSet struct {
+	keyAttrs []string
+	sorter   *extsort.Sorter
+	items    int64
+}
+
+func newItemSet(keyAttrs []string, sorter *extsort.Sorter) *itemSet {
+	return &itemSet{keyAttrs: keyAttrs, sorter: sorter}
+}
+
+func (s *itemSet) add(items []map[string]interface{}) error {
+	for _, item := range items {
+		id, ok := table.KeyID(item, s.keyAttrs)
+		if !ok {
+			return fmt.Errorf("item %v does not have all of the key attributes %v", table.Key(item, s.keyAttrs), s.keyAttrs)
+		}
+		hash, err := contentHash(item)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(entry{Key: table.Key(item, s.keyAttrs), Hash: hash[:]})
+		if err != nil {
+			return err
+		}
+		if err := s.sorter.Add(extsort.Record{ID: id, Item: b}); err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.items, 1)
+	}
+	return nil
+}
+
+// contentHash hashes the json of the item. Maps are encoded with sorted keys and binary as base64, so an item
+// scanned from the table hashes the same as the item read back from a json archive.
+func contentHash(item map[string]interface{}) ([sha256.Size]byte, error) {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(b), nil
+}
+
+// Compare scans the table and streams the archive at the same time, then reports the keys missing from either
+// side and the keys whose content differs. It returns ErrMismatch if there are any. The keys and hashes of both
+// sides are sorted on disk, so the table can be far bigger than memory.
+func Compare(c *VerifyConfig) error {
+	s := awssession.New(c.Region)
+	return compare(dynamodb.New(s), s3.New(s), c)
+}
+
+func compare(db dynamodbiface.DynamoDBAPI, svc s3iface.S3API, c *VerifyConfig) error {
+	keyAttrs, err := table.KeySchema(db, c.TableName)
+	if err != nil {
+		return err
+	}
+	files, err := source.Files(svc, c.Bucket, c.Source)
+	if err != nil {
+		return err
+	}
+	if c.Readers < 1 {
+		c.Readers = 1
+	}
+
+	if c.SortItems < 1 {
+		c.SortItems = 100000
+	}
+	dir, err := ioutil.TempDir(c.TempDir, "dynamotools-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	live := newItemSet(keyAttrs, extsort.NewSorter(dir, c.SortItems))
+	archived := newItemSet(keyAttrs, extsort.NewSorter(dir, c.SortItems))
+	var grp errgroup.Group
+	grp.Go(func() error {
+		log.Printf("scanning %s", c.TableName)
+		return archive.ScanTable(db, c.TableName, c.ScanPartitions, c.ScanLimit, live.add)
+	})
+	sem := make(chan struct{}, c.Readers)
+	for _, key := range files {
+		key := key
+		grp.Go(func() error {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return source.Stream(svc, c.Bucket, key, nil, archived.add)
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if c.ReportFile != "" {
+		f, err := os.Create(c.ReportFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	a, err := archived.sorter.Sorted()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	l, err := live.sorter.Sorted()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	archivedKeys := extsort.NewUnique(a)
+	counts, err := report(w, archivedKeys, extsort.NewUnique(l))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d items in %s, %d items in the archive (%d duplicate keys)", live.items, c.TableName, archived.items, archivedKeys.Duplicates)
+	log.Printf("%d missing from the table, %d missing from the archive, %d different",
+		counts[MissingFromTable], counts[MissingFromArchive], counts[Different])
+	if live.items != archived.items || len(counts) != 0 {
+		return ErrMismatch
+	}
+	log.Printf("archive matches %s", c.TableName)
+	return nil
+}
+
+// report walks both sides in key order and writes a json line for every key which is missing from one side or
+// different
+func report(w io.Writer, archived, live *extsort.Unique) (map[string]int, error) {
+	type line struct {
+		Status string                 `json:"status"`
+		Key    map[string]interface{} `json:"key"`
+	}
+	counts := map[string]int{}
+	enc := json.NewEncoder(w)
+	write := func(status string, e entry) error {
+		counts[status]++
+		return enc.Encode(line{Status: status, Key: e.Key})
+	}
+
+	a, err := archived.Next()
+	if err != nil {
+		return nil, err
+	}
+	l, err := live.Next()
+	if err != nil {
+		return nil, err
+	}
+	for a != nil || l != nil {
+		switch {
+		case l == nil || (a != nil && a.ID < l.ID):
+			ae, derr := decodeEntry(a)
+			if derr != nil {
+				return nil, derr
+			}
+			if err := write(MissingFromTable, ae); err != nil {
+				return nil, err
+			}
+			a, err = archived.Next()
+		case a == nil || l.ID < a.ID:
+			le, derr := decodeEntry(l)
+			if derr != nil {
+				return nil, derr
+			}
+			if err := write(MissingFromArchive, le); err != nil {
+				return nil, err
+			}
+			l, err = live.Next()
+		default:
+			ae, derr := decodeEntry(a)
+			if derr != nil {
+				return nil, derr
+			}
+			le, derr := decodeEntry(l)
+			if derr != nil {
+				return nil, derr
+			}
+			if !bytes.Equal(ae.Hash, le.Hash) {
+				if err := write(Different, ae); err != nil {
+					return nil, err
+				}
+			}
+			if a, err = archived.Next(); err != nil {
+				return nil, err
+			}
+			l, err = live.Next()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func decodeEntry(r *extsort.Record) (entry, error) {
+	var e entry
+	err := json.Unmarshal(r.Item, &e)
+	return e, err
+}
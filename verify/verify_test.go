@@ -0,0 +1,157 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeTable is a table keyed by id, scanned in a single page by segment 0
+type fakeTable struct {
+	dynamodbiface.DynamoDBAPI
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (ft *fakeTable) DescribeTable(in *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{Table: &dynamodb.TableDescription{
+		TableName: in.TableName,
+		KeySchema: []*dynamodb.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: aws.String(dynamodb.KeyTypeHash)}},
+	}}, nil
+}
+
+func (ft *fakeTable) ScanPages(in *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	if aws.Int64Value(in.Segment) == 0 {
+		fn(&dynamodb.ScanOutput{Items: ft.items}, true)
+	} else {
+		fn(&dynamodb.ScanOutput{}, true)
+	}
+	return nil
+}
+
+// fakeBucket serves the archive files from memory
+type fakeBucket struct {
+	s3iface.S3API
+	files map[string]string
+}
+
+func (fb *fakeBucket) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(fb.files[aws.StringValue(in.Key)]))}, nil
+}
+
+func TestCompare(t *testing.T) {
+	live := []map[string]interface{}{
+		{"id": "a", "n": 1.0, "tags": []interface{}{"x"}},
+		{"id": "b", "n": 2.0},
+		{"id": "c", "n": 3.0},
+	}
+	tests := []struct {
+		name     string
+		archive  string
+		want     []string
+		mismatch bool
+	}{
+		{"match", `{"id": "b", "n": 2}
+{"tags": ["x"], "n": 1, "id": "a"}
+{"id": "c", "n": 3}
+`, nil, false},
+		{"different", `{"id": "a", "n": 1, "tags": ["x"]}
+{"id": "b", "n": 20}
+{"id": "c", "n": 3}
+`, []string{`{"status":"different","key":{"id":"b"}}`}, true},
+		{"missing from the table", `{"id": "a", "n": 1, "tags": ["x"]}
+{"id": "b", "n": 2}
+{"id": "c", "n": 3}
+{"id": "d", "n": 4}
+`, []string{`{"status":"missing-from-table","key":{"id":"d"}}`}, true},
+		{"missing from the archive", `{"id": "a", "n": 1, "tags": ["x"]}
+{"id": "c", "n": 3}
+`, []string{`{"status":"missing-from-archive","key":{"id":"b"}}`}, true},
+		{"duplicate in the archive", `{"id": "a", "n": 1, "tags": ["x"]}
+{"id": "b", "n": 2}
+{"id": "b", "n": 2}
+{"id": "c", "n": 3}
+`, nil, true},
+	}
+	for _, tt := range tests {
+		db := &fakeTable{}
+		for _, item := range live {
+			av, err := dynamodbattribute.MarshalMap(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.items = append(db.items, av)
+		}
+		dir, err := ioutil.TempDir("", "dynamotools-verify-test-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		reportFile := filepath.Join(dir, "report.jsonl")
+
+		err = compare(db, &fakeBucket{files: map[string]string{"jobs.json": tt.archive}}, &VerifyConfig{
+			TableName:      "jobs",
+			Bucket:         "backups",
+			Source:         "jobs.json",
+			ScanPartitions: 2,
+			ReportFile:     reportFile,
+			SortItems:      2,
+			TempDir:        dir,
+		})
+		if (err == ErrMismatch) != tt.mismatch || (err != nil && err != ErrMismatch) {
+			t.Errorf("%s: error %v, want mismatch %v", tt.name, err, tt.mismatch)
+		}
+		out, err := ioutil.ReadFile(reportFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+			if line != "" {
+				got = append(got, line)
+			}
+		}
+		sort.Strings(got)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: reported\n%s\nwant\n%s", tt.name, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	// an item scanned from the table and the same item read back from json hash the same
+	var scanned map[string]interface{}
+	av, err := dynamodbattribute.MarshalMap(map[string]interface{}{"id": "a", "n": 1.5, "m": map[string]interface{}{"b": true, "a": nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dynamodbattribute.UnmarshalMap(av, &scanned); err != nil {
+		t.Fatal(err)
+	}
+	var archived map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"m": {"a": null, "b": true}, "n": 1.5, "id": "a"}`), &archived); err != nil {
+		t.Fatal(err)
+	}
+	a, err := contentHash(scanned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := contentHash(archived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("the scanned and archived item hash differently")
+	}
+}